@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -156,11 +157,20 @@ func processFile(
 		log.Fatal(err)
 	}
 
-	meta, markdown, err := mark.ExtractMeta(markdown)
+	source := markdown
+
+	meta, markdown, err := mark.ParseMarkdownFrontmatter(markdown)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// lines of stripped headers and front matter are added to line numbers
+	// reported for the body, so they point to lines of the file
+	headerLines := bytes.Count(
+		source[:len(source)-len(markdown)],
+		[]byte("\n"),
+	)
+
 	stdlib, err := stdlib.New(api)
 	if err != nil {
 		log.Fatal(err)
@@ -198,12 +208,44 @@ func processFile(
 		}
 	}
 
-	links, err := mark.ResolveRelativeLinks(api, meta, markdown, ".")
+	links, unresolved, err := mark.PreviewRelativeLinks(
+		context.Background(),
+		mark.NewLinkResolver(api),
+		meta,
+		markdown,
+		".",
+	)
 	if err != nil {
 		log.Fatalf(err, "unable to resolve relative links")
 	}
 
-	markdown = mark.SubstituteLinks(markdown, links)
+	for _, link := range unresolved {
+		log.Warningf(
+			nil,
+			"relative link %q at line %d can't be resolved to Confluence page",
+			link.Link,
+			headerLines+link.Line,
+		)
+	}
+
+	// anchor-only links are resolved to themselves and need no substitution
+	changed := 0
+	for _, link := range links {
+		if link.From != link.To {
+			changed++
+		}
+	}
+
+	markdown, substituted := mark.SubstituteLinks(markdown, links)
+	if substituted == 0 && changed > 0 {
+		log.Warningf(
+			nil,
+			"none of %d resolved relative links were substituted",
+			changed,
+		)
+	} else {
+		log.Debugf(nil, "substituted %d relative links", substituted)
+	}
 
 	if flags.DryRun {
 		flags.CompileOnly = true
@@ -215,7 +257,13 @@ func processFile(
 	}
 
 	if flags.CompileOnly {
-		fmt.Println(mark.CompileMarkdown(markdown, stdlib))
+		fmt.Println(mark.CompileMarkdown(
+			markdown,
+			stdlib,
+			mark.WithMissingImageWarnings("."),
+			mark.WithPageLinks(links),
+			mark.WithConfluenceBaseURL(api.BaseURL),
+		))
 		os.Exit(0)
 	}
 
@@ -294,7 +342,13 @@ func processFile(
 		markdown = mark.DropDocumentLeadingH1(markdown)
 	}
 
-	html := mark.CompileMarkdown(markdown, stdlib)
+	html := mark.CompileMarkdown(
+		markdown,
+		stdlib,
+		mark.WithMissingImageWarnings("."),
+		mark.WithPageLinks(links),
+		mark.WithConfluenceBaseURL(api.BaseURL),
+	)
 
 	{
 		var buffer bytes.Buffer
@@ -319,7 +373,24 @@ func processFile(
 		html = buffer.String()
 	}
 
-	err = api.UpdatePage(target, html, flags.MinorEdit, meta.Labels)
+	contentAppearance := meta.ContentAppearance
+	if contentAppearance != "" && !api.IsCloud() {
+		log.Warningf(
+			nil,
+			"%s header is supported only by Confluence Cloud, ignoring it",
+			mark.HeaderContentAppearance,
+		)
+
+		contentAppearance = ""
+	}
+
+	err = api.UpdatePage(
+		target,
+		html,
+		flags.MinorEdit,
+		meta.Labels,
+		contentAppearance,
+	)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -8,8 +8,10 @@ import (
 	"io/ioutil"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/kovetskiy/gopencils"
 	"github.com/kovetskiy/lorg"
@@ -18,9 +20,41 @@ import (
 )
 
 type User struct {
-	AccountID string `json:"accountId"`
+	AccountID   string `json:"accountId"`
+	Type        string `json:"type"`
+	DisplayName string `json:"displayName"`
 }
 
+// AnonymousUser is used instead of users which are returned as null by
+// Confluence Cloud after they requested their personal data erasure.
+var AnonymousUser = User{
+	Type:        "anonymous",
+	DisplayName: "Anonymous",
+}
+
+// orAnonymous returns AnonymousUser in place of anonymised (null) user.
+func orAnonymous(user *User) *User {
+	if user == nil {
+		anonymous := AnonymousUser
+
+		return &anonymous
+	}
+
+	return user
+}
+
+// ConfluenceEdition is the edition of Confluence instance API points to,
+// which affects format of page URLs.
+type ConfluenceEdition int
+
+const (
+	// Server is Confluence Server or Data Center.
+	Server ConfluenceEdition = iota
+
+	// Cloud is Confluence Cloud.
+	Cloud
+)
+
 type API struct {
 	rest *gopencils.Resource
 
@@ -28,6 +62,10 @@ type API struct {
 	// but it's only way to set permissions
 	json    *gopencils.Resource
 	BaseURL string
+
+	// Edition is detected by host name of the base URL, it can be set
+	// explicitly for Cloud instances on custom domains.
+	Edition ConfluenceEdition
 }
 
 type SpaceInfo struct {
@@ -56,11 +94,23 @@ type PageInfo struct {
 		Title string `json:"title"`
 	} `json:"ancestors"`
 
+	History struct {
+		LastUpdated struct {
+			By *User `json:"by"`
+		} `json:"lastUpdated"`
+	} `json:"history"`
+
 	Links struct {
 		Full string `json:"webui"`
 	} `json:"_links"`
 }
 
+// LastUpdatedBy returns author of the last page update; it's only known for
+// pages obtained with GetPageByID.
+func (page *PageInfo) LastUpdatedBy() *User {
+	return orAnonymous(page.History.LastUpdated.By)
+}
+
 type AttachmentInfo struct {
 	Filename string `json:"title"`
 	ID       string `json:"id"`
@@ -100,11 +150,64 @@ func NewAPI(baseURL string, username string, password string) *API {
 		json.Logger = &tracer{"json-rpc:"}
 	}
 
+	edition := Server
+	if isCloudURL(baseURL) {
+		edition = Cloud
+	}
+
 	return &API{
 		rest:    rest,
 		json:    json,
 		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Edition: edition,
+	}
+}
+
+// WithTimeout returns copy of API which gives up requests taking longer
+// than timeout; requests made by API itself are not affected.
+func (api *API) WithTimeout(timeout time.Duration) *API {
+	copied := *api
+	copied.rest = withClientTimeout(api.rest, timeout)
+	copied.json = withClientTimeout(api.json, timeout)
+
+	return &copied
+}
+
+func withClientTimeout(
+	resource *gopencils.Resource,
+	timeout time.Duration,
+) *gopencils.Resource {
+	client := http.Client{}
+	if resource.Api.Client != nil {
+		client = *resource.Api.Client
 	}
+
+	client.Timeout = timeout
+
+	api := *resource.Api
+	api.Client = &client
+
+	copied := *resource
+	copied.Api = &api
+
+	return &copied
+}
+
+// IsCloud reports whether API points to Confluence Cloud instance rather
+// than to Server or Data Center one.
+func (api *API) IsCloud() bool {
+	return api.Edition == Cloud
+}
+
+// isCloudURL reports whether URL belongs to Confluence Cloud, which is
+// hosted on atlassian.net.
+func isCloudURL(baseURL string) bool {
+	address, err := url.Parse(baseURL)
+	if err != nil {
+		return false
+	}
+
+	return strings.HasSuffix(address.Hostname(), ".atlassian.net")
 }
 
 func (api *API) FindRootPage(space string) (*PageInfo, error) {
@@ -189,6 +292,45 @@ func (api *API) FindPage(space string, title string, pageType string) (*PageInfo
 	return &result.Results[0], nil
 }
 
+// FindPageByCQL returns the only page matching given CQL expression, e.g.
+// `space = DEV and label = "runbooks"`. It's an error if no pages or more
+// than one page match.
+func (api *API) FindPageByCQL(cql string) (*PageInfo, error) {
+	result := struct {
+		Results []PageInfo `json:"results"`
+	}{}
+
+	request, err := api.rest.Res(
+		"content/search", &result,
+	).Get(map[string]string{
+		"cql":    cql,
+		"expand": "ancestors,version",
+		"limit":  "2",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Raw.StatusCode != 200 {
+		return nil, newErrorStatusNotOK(request)
+	}
+
+	switch len(result.Results) {
+	case 0:
+		return nil, karma.Describe("cql", cql).Reason(
+			"no pages found",
+		)
+
+	case 1:
+		return &result.Results[0], nil
+
+	default:
+		return nil, karma.Describe("cql", cql).Reason(
+			"more than one page found",
+		)
+	}
+}
+
 func (api *API) CreateAttachment(
 	pageID string,
 	name string,
@@ -408,7 +550,9 @@ func (api *API) GetAttachments(pageID string) ([]AttachmentInfo, error) {
 func (api *API) GetPageByID(pageID string) (*PageInfo, error) {
 	request, err := api.rest.Res(
 		"content/"+pageID, &PageInfo{},
-	).Get(map[string]string{"expand": "ancestors,version"})
+	).Get(map[string]string{
+		"expand": "ancestors,version,history.lastUpdated",
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -470,6 +614,7 @@ func (api *API) CreatePage(
 
 func (api *API) UpdatePage(
 	page *PageInfo, newContent string, minorEdit bool, newLabels []string,
+	contentAppearance string,
 ) error {
 	nextPageVersion := page.Version.Number + 1
 	oldAncestors := []map[string]interface{}{}
@@ -492,6 +637,18 @@ func (api *API) UpdatePage(
 		}
 	}
 
+	metadata := map[string]interface{}{
+		"labels": labels,
+	}
+
+	if contentAppearance != "" {
+		metadata["properties"] = map[string]interface{}{
+			"content-appearance-published": map[string]interface{}{
+				"value": contentAppearance,
+			},
+		}
+	}
+
 	payload := map[string]interface{}{
 		"id":    page.ID,
 		"type":  page.Type,
@@ -507,9 +664,7 @@ func (api *API) UpdatePage(
 				"representation": "storage",
 			},
 		},
-		"metadata": map[string]interface{}{
-			"labels": labels,
-		},
+		"metadata": metadata,
 	}
 
 	request, err := api.rest.Res(
@@ -529,7 +684,7 @@ func (api *API) UpdatePage(
 func (api *API) GetUserByName(name string) (*User, error) {
 	var response struct {
 		Results []struct {
-			User User
+			User *User
 		}
 	}
 
@@ -551,7 +706,16 @@ func (api *API) GetUserByName(name string) (*User, error) {
 			)
 	}
 
-	return &response.Results[0].User, nil
+	// anonymised user can't be referred to, so it's as good as not found
+	if response.Results[0].User == nil {
+		return nil, karma.
+			Describe("name", name).
+			Reason(
+				"user with given name is anonymised",
+			)
+	}
+
+	return response.Results[0].User, nil
 }
 
 func (api *API) GetCurrentUser() (*User, error) {
@@ -577,6 +741,10 @@ func (api *API) RestrictPageUpdatesCloud(
 		return err
 	}
 
+	if user.AccountID == "" {
+		return errors.New("account id of the current user is unknown")
+	}
+
 	var result interface{}
 
 	request, err := api.rest.
@@ -660,25 +828,55 @@ func (api *API) RestrictPageUpdates(
 	return err
 }
 
-func newErrorStatusNotOK(request *gopencils.Resource) error {
-	if request.Raw.StatusCode == 401 {
-		return errors.New(
-			"Confluence API returned unexpected status: 401 (Unauthorized)",
-		)
-	}
+// StatusError is returned when Confluence API responds with unexpected
+// HTTP status.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Output     string
+}
 
-	if request.Raw.StatusCode == 404 {
-		return errors.New(
-			"Confluence API returned unexpected status: 404 (Not Found)",
-		)
-	}
+func (err *StatusError) Error() string {
+	switch err.StatusCode {
+	case 401:
+		return "Confluence API returned unexpected status: 401 (Unauthorized)"
 
-	output, _ := ioutil.ReadAll(request.Raw.Body)
-	defer request.Raw.Body.Close()
+	case 404:
+		return "Confluence API returned unexpected status: 404 (Not Found)"
+	}
 
-	return fmt.Errorf(
+	return fmt.Sprintf(
 		"Confluence API returned unexpected status: %v, "+
 			"output: %q",
-		request.Raw.Status, output,
+		err.Status, err.Output,
 	)
 }
+
+// Temporary reports whether the same request might succeed later.
+func (err *StatusError) Temporary() bool {
+	return err.StatusCode >= 500
+}
+
+func newErrorStatusNotOK(request *gopencils.Resource) error {
+	return newStatusError(request.Raw)
+}
+
+// newStatusError returns StatusError for response with unexpected status,
+// including the response body unless it's 401 or 404.
+func newStatusError(response *http.Response) error {
+	statusErr := &StatusError{
+		StatusCode: response.StatusCode,
+		Status:     response.Status,
+	}
+
+	if statusErr.StatusCode == 401 || statusErr.StatusCode == 404 {
+		return statusErr
+	}
+
+	output, _ := ioutil.ReadAll(response.Body)
+	defer response.Body.Close()
+
+	statusErr.Output = string(output)
+
+	return statusErr
+}
@@ -0,0 +1,109 @@
+package confluence
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI_WithTimeout(t *testing.T) {
+	api := NewAPI("https://confluence.example.com", "user", "password")
+
+	timed := api.WithTimeout(time.Second)
+
+	assert.Equal(t, time.Second, timed.rest.Api.Client.Timeout)
+	assert.Equal(t, time.Second, timed.json.Api.Client.Timeout)
+	assert.Equal(t, api.BaseURL, timed.BaseURL)
+
+	assert.Zero(t, api.rest.Api.Client.Timeout)
+	assert.Zero(t, api.json.Api.Client.Timeout)
+}
+
+func TestPageInfo_LastUpdatedBy(t *testing.T) {
+	var page PageInfo
+
+	err := json.Unmarshal(
+		[]byte(`{"history": {"lastUpdated": {"by": {`+
+			`"type": "known", "accountId": "42", "displayName": "John"`+
+			`}}}}`),
+		&page,
+	)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		&User{AccountID: "42", Type: "known", DisplayName: "John"},
+		page.LastUpdatedBy(),
+	)
+
+	page = PageInfo{}
+
+	err = json.Unmarshal(
+		[]byte(`{"history": {"lastUpdated": {"by": null}}}`),
+		&page,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, &AnonymousUser, page.LastUpdatedBy())
+}
+
+func TestOrAnonymous(t *testing.T) {
+	user := &User{AccountID: "42"}
+	assert.Same(t, user, orAnonymous(user))
+
+	anonymous := orAnonymous(nil)
+	assert.Equal(t, AnonymousUser, *anonymous)
+
+	// returned user is a copy, so AnonymousUser can't be changed through it
+	anonymous.DisplayName = "Changed"
+	assert.Equal(t, "Anonymous", AnonymousUser.DisplayName)
+}
+
+func TestFindPageByCQL(t *testing.T) {
+	var (
+		query    url.Values
+		response string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			assert.Equal(t, "/rest/api/content/search", request.URL.Path)
+
+			query = request.URL.Query()
+
+			writer.Write([]byte(response))
+		},
+	))
+	defer server.Close()
+
+	api := NewAPI(server.URL, "user", "password")
+
+	cql := `space = DEV and label = "runbooks" & title ~ "a+b"`
+
+	response = `{"results": [{"id": "42", "title": "Runbook"}]}`
+
+	page, err := api.FindPageByCQL(cql)
+	assert.NoError(t, err)
+	assert.Equal(t, "42", page.ID)
+	assert.Equal(t, "Runbook", page.Title)
+	assert.Equal(t, url.Values{
+		"cql":    {cql},
+		"expand": {"ancestors,version"},
+		"limit":  {"2"},
+	}, query)
+
+	response = `{"results": []}`
+
+	_, err = api.FindPageByCQL(cql)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no pages found")
+
+	response = `{"results": [{"id": "42"}, {"id": "43"}]}`
+
+	_, err = api.FindPageByCQL(cql)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "more than one page found")
+}
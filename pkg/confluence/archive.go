@@ -0,0 +1,94 @@
+package confluence
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/reconquest/karma-go"
+)
+
+// ErrArchiveNotSupported is returned by ArchivePage and UnarchivePage when
+// API points to Confluence Server or Data Center, which have no archiving.
+var ErrArchiveNotSupported = errors.New(
+	"page archiving is supported only by Confluence Cloud",
+)
+
+// ArchivePage moves page into the space archive. Archiving is performed by
+// Confluence as a long running task, so the page might still be listed as
+// current for a while after this call.
+func (api *API) ArchivePage(id string) error {
+	if !api.IsCloud() {
+		return ErrArchiveNotSupported
+	}
+
+	pageID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return karma.Format(err, "invalid page id: %q", id)
+	}
+
+	payload := map[string]interface{}{
+		"pages": []map[string]interface{}{
+			{"id": pageID},
+		},
+	}
+
+	request, err := api.rest.Res(
+		"content/archive", &map[string]interface{}{},
+	).Post(payload)
+	if err != nil {
+		return err
+	}
+
+	if request.Raw.StatusCode != 200 && request.Raw.StatusCode != 202 {
+		return newErrorStatusNotOK(request)
+	}
+
+	return nil
+}
+
+// UnarchivePage restores archived page by changing its status back to
+// current.
+func (api *API) UnarchivePage(id string) error {
+	if !api.IsCloud() {
+		return ErrArchiveNotSupported
+	}
+
+	request, err := api.rest.Res(
+		"content/"+id, &PageInfo{},
+	).Get(map[string]string{
+		"status": "archived",
+		"expand": "version",
+	})
+	if err != nil {
+		return err
+	}
+
+	if request.Raw.StatusCode != 200 {
+		return newErrorStatusNotOK(request)
+	}
+
+	page := request.Response.(*PageInfo)
+
+	payload := map[string]interface{}{
+		"id":     page.ID,
+		"type":   page.Type,
+		"title":  page.Title,
+		"status": "current",
+		"version": map[string]interface{}{
+			"number": page.Version.Number + 1,
+		},
+	}
+
+	request, err = api.rest.Res(
+		"content/"+id, &map[string]interface{}{},
+	).Put(payload)
+	if err != nil {
+		return err
+	}
+
+	if request.Raw.StatusCode != 200 {
+		return newErrorStatusNotOK(request)
+	}
+
+	return nil
+}
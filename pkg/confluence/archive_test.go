@@ -0,0 +1,121 @@
+package confluence
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchivePage_Cloud(t *testing.T) {
+	var method, path, body string
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			data, _ := ioutil.ReadAll(request.Body)
+
+			method, path, body = request.Method, request.URL.Path, string(data)
+
+			writer.WriteHeader(http.StatusAccepted)
+			writer.Write([]byte(`{"id": "task"}`))
+		},
+	))
+	defer server.Close()
+
+	api := NewAPI(server.URL, "user", "password")
+	api.Edition = Cloud
+
+	err := api.ArchivePage("42")
+	assert.NoError(t, err)
+	assert.Equal(t, http.MethodPost, method)
+	assert.Equal(t, "/rest/api/content/archive", path)
+	assert.JSONEq(t, `{"pages": [{"id": 42}]}`, body)
+
+	err = api.ArchivePage("page")
+	assert.Error(t, err)
+}
+
+func TestUnarchivePage_Cloud(t *testing.T) {
+	var requests []string
+
+	var body string
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			requests = append(
+				requests,
+				request.Method+" "+request.URL.Path+"?"+request.URL.RawQuery,
+			)
+
+			if request.Method == http.MethodPut {
+				data, _ := ioutil.ReadAll(request.Body)
+				body = string(data)
+			}
+
+			writer.Write([]byte(`{` +
+				`"id": "42", "type": "page", "title": "Page", ` +
+				`"version": {"number": 3}` +
+				`}`))
+		},
+	))
+	defer server.Close()
+
+	api := NewAPI(server.URL, "user", "password")
+	api.Edition = Cloud
+
+	err := api.UnarchivePage("42")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"GET /rest/api/content/42?expand=version&status=archived",
+		"PUT /rest/api/content/42?",
+	}, requests)
+	assert.JSONEq(
+		t,
+		`{
+			"id": "42",
+			"type": "page",
+			"title": "Page",
+			"status": "current",
+			"version": {"number": 4}
+		}`,
+		body,
+	)
+}
+
+func TestArchivePage_CloudError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			writer.Write([]byte("maintenance"))
+		},
+	))
+	defer server.Close()
+
+	api := NewAPI(server.URL, "user", "password")
+	api.Edition = Cloud
+
+	err := api.ArchivePage("42")
+	if assert.IsType(t, &StatusError{}, err) {
+		assert.Equal(t, 503, err.(*StatusError).StatusCode)
+		assert.True(t, err.(*StatusError).Temporary())
+	}
+}
+
+func TestArchivePage_Server(t *testing.T) {
+	requested := false
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			requested = true
+		},
+	))
+	defer server.Close()
+
+	api := NewAPI(server.URL, "user", "password")
+
+	assert.Equal(t, ErrArchiveNotSupported, api.ArchivePage("42"))
+	assert.Equal(t, ErrArchiveNotSupported, api.UnarchivePage("42"))
+	assert.False(t, requested)
+}
@@ -0,0 +1,143 @@
+package confluence
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/reconquest/karma-go"
+	"github.com/reconquest/pkg/log"
+)
+
+// PageEvent is a page change notification received from Confluence.
+type PageEvent struct {
+	Type   string `json:"type"`
+	PageID string `json:"pageId"`
+	User   string `json:"user"`
+}
+
+// SubscribePageEvents connects to Server-Sent Events endpoint of Confluence
+// Data Center and sends page events of given space to the events channel
+// until context is cancelled or the stream is closed by the server.
+func (api *API) SubscribePageEvents(
+	ctx context.Context,
+	space string,
+	events chan<- PageEvent,
+) error {
+	request, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		api.BaseURL+"/rest/api/events/stream?"+url.Values{
+			"spaceKey": {space},
+		}.Encode(),
+		nil,
+	)
+	if err != nil {
+		return karma.Format(err, "unable to create events request")
+	}
+
+	// stream is requested with the same client and credentials as the rest
+	// of API, so proxy and TLS settings apply to it too
+	if auth := api.rest.Api.BasicAuth; auth != nil {
+		request.SetBasicAuth(auth.Username, auth.Password)
+	}
+
+	request.Header.Set("Accept", "text/event-stream")
+
+	client := api.rest.Api.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return karma.Format(err, "unable to subscribe to page events")
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return newStatusError(response)
+	}
+
+	return readPageEvents(ctx, response.Body, events)
+}
+
+// readPageEvents parses Server-Sent Events stream and sends page events to
+// the events channel until context is cancelled or the stream is over.
+func readPageEvents(
+	ctx context.Context,
+	stream io.Reader,
+	events chan<- PageEvent,
+) error {
+	var (
+		name string
+		data strings.Builder
+	)
+
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			// blank line dispatches the event
+			if data.Len() > 0 {
+				err := sendPageEvent(ctx, events, name, data.String())
+				if err != nil {
+					return err
+				}
+			}
+
+			name = ""
+			data.Reset()
+
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteString("\n")
+			}
+
+			data.WriteString(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return scanner.Err()
+}
+
+func sendPageEvent(
+	ctx context.Context,
+	events chan<- PageEvent,
+	name string,
+	data string,
+) error {
+	var event PageEvent
+
+	err := json.Unmarshal([]byte(data), &event)
+	if err != nil {
+		log.Warningf(err, "unable to decode page event: %s", data)
+
+		return nil
+	}
+
+	if event.Type == "" {
+		event.Type = name
+	}
+
+	select {
+	case events <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,86 @@
+package confluence
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadPageEvents(t *testing.T) {
+	stream := strings.Join([]string{
+		": keep-alive",
+		"",
+		"event: page_updated",
+		`data: {"pageId": "42", "user": "john"}`,
+		"",
+		`data: {"type": "page_created",`,
+		`data:  "pageId": "43"}`,
+		"",
+		"event: page_removed",
+		"data: not json",
+		"",
+		"event: page_updated",
+		`data: {"pageId": "44"}`,
+	}, "\n")
+
+	events := make(chan PageEvent, 10)
+
+	err := readPageEvents(
+		context.Background(),
+		strings.NewReader(stream),
+		events,
+	)
+	assert.NoError(t, err)
+
+	close(events)
+
+	var received []PageEvent
+	for event := range events {
+		received = append(received, event)
+	}
+
+	// event which is not followed by blank line is not dispatched
+	assert.Equal(t, []PageEvent{
+		{Type: "page_updated", PageID: "42", User: "john"},
+		{Type: "page_created", PageID: "43"},
+	}, received)
+}
+
+func TestReadPageEvents_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := readPageEvents(
+		ctx,
+		strings.NewReader("data: {\"pageId\": \"42\"}\n\n"),
+		make(chan PageEvent),
+	)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestSubscribePageEvents_Status(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			writer.WriteHeader(http.StatusBadGateway)
+			writer.Write([]byte("upstream is down"))
+		},
+	))
+	defer server.Close()
+
+	api := NewAPI(server.URL, "user", "password")
+
+	err := api.SubscribePageEvents(
+		context.Background(),
+		"SPACE",
+		make(chan PageEvent),
+	)
+	if assert.IsType(t, &StatusError{}, err) {
+		assert.Equal(t, 502, err.(*StatusError).StatusCode)
+		assert.Equal(t, "upstream is down", err.(*StatusError).Output)
+		assert.True(t, err.(*StatusError).Temporary())
+	}
+}
@@ -0,0 +1,100 @@
+package mark
+
+import (
+	"html"
+	"io"
+	"regexp"
+	"strings"
+
+	bf "github.com/kovetskiy/blackfriday/v2"
+)
+
+var reHeadingBadge = regexp.MustCompile(`\s*\[badge:\s*([^\]]*?)\s*\]\s*$`)
+
+// badgeColors are colors supported by Confluence status macro.
+var badgeColors = map[string]string{
+	"grey":   "Grey",
+	"red":    "Red",
+	"yellow": "Yellow",
+	"green":  "Green",
+	"blue":   "Blue",
+	"purple": "Purple",
+}
+
+type headingBadge struct {
+	label string
+	color string
+}
+
+// WithHeadingBadges renders `[badge: <label> <color>]` given at the end of
+// heading as status macro, e.g. `## Design [badge: Draft Yellow]`. Color is
+// optional and defaults to grey.
+func WithHeadingBadges() RendererOption {
+	return func(renderer *ConfluenceRenderer) {
+		renderer.headingBadges = true
+	}
+}
+
+// parseBadge splits badge into label and optional trailing color.
+func parseBadge(raw string) headingBadge {
+	badge := headingBadge{label: raw}
+
+	index := strings.LastIndexAny(raw, " \t")
+	if index < 0 {
+		return badge
+	}
+
+	if color, ok := badgeColors[strings.ToLower(raw[index+1:])]; ok {
+		badge.label = strings.TrimSpace(raw[:index])
+		badge.color = color
+	}
+
+	return badge
+}
+
+// extractHeadingBadge removes badge from the heading text, so it doesn't
+// end up in heading anchor, and returns it.
+func extractHeadingBadge(heading *bf.Node) *headingBadge {
+	text := heading.LastChild
+	if text == nil || text.Type != bf.Text {
+		return nil
+	}
+
+	matches := reHeadingBadge.FindSubmatchIndex(text.Literal)
+	if matches == nil {
+		return nil
+	}
+
+	badge := parseBadge(string(text.Literal[matches[2]:matches[3]]))
+
+	autoID := heading.HeadingID == bf.SanitizedAnchorName(nodeText(heading))
+
+	text.Literal = text.Literal[:matches[0]]
+
+	if autoID {
+		heading.HeadingID = bf.SanitizedAnchorName(nodeText(heading))
+	}
+
+	return &badge
+}
+
+func (renderer *ConfluenceRenderer) renderHeadingBadge(
+	writer io.Writer,
+	badge *headingBadge,
+) {
+	io.WriteString(writer, " ")
+
+	renderer.Stdlib.Templates.ExecuteTemplate(
+		writer,
+		"ac:status",
+		struct {
+			Color  string
+			Title  string
+			Subtle bool
+		}{
+			badge.color,
+			html.EscapeString(badge.label),
+			false,
+		},
+	)
+}
@@ -0,0 +1,45 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileMarkdown_HeadingBadges(t *testing.T) {
+	assert.Equal(
+		t,
+		text(
+			`<ac:structured-macro ac:name="anchor"><ac:parameter ac:name="">design</ac:parameter></ac:structured-macro>`,
+			`<h2>Design `+
+				`<ac:structured-macro ac:name="status">`+
+				`<ac:parameter ac:name="colour">Yellow</ac:parameter>`+
+				`<ac:parameter ac:name="title">In Review</ac:parameter>`+
+				`<ac:parameter ac:name="subtle">false</ac:parameter>`+
+				`</ac:structured-macro></h2>`,
+			"",
+			`<ac:structured-macro ac:name="anchor"><ac:parameter ac:name="">api</ac:parameter></ac:structured-macro>`,
+			`<h2>API `+
+				`<ac:structured-macro ac:name="status">`+
+				`<ac:parameter ac:name="colour">Grey</ac:parameter>`+
+				`<ac:parameter ac:name="title">Draft</ac:parameter>`+
+				`<ac:parameter ac:name="subtle">false</ac:parameter>`+
+				`</ac:structured-macro></h2>`,
+			"",
+		),
+		compile(
+			text(
+				"## Design [badge: In Review yellow]",
+				"",
+				"## API [badge: Draft]",
+			),
+			WithHeadingBadges(),
+		),
+	)
+
+	assert.Contains(
+		t,
+		compile("## Design [badge: Draft]"),
+		"[badge: Draft]",
+	)
+}
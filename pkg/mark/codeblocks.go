@@ -0,0 +1,120 @@
+package mark
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	bf "github.com/kovetskiy/blackfriday/v2"
+)
+
+// CodeBlock is a fenced code block found in markdown document along with
+// parameters given in its info string.
+type CodeBlock struct {
+	Language    string
+	Title       string
+	Theme       string
+	Collapse    bool
+	LineNumbers bool
+	Content     string
+}
+
+// ExtractCodeBlocks returns all fenced code blocks of the document in order
+// of appearance without rendering it.
+func ExtractCodeBlocks(markdown []byte) []CodeBlock {
+	document := bf.New(
+		bf.WithExtensions(DefaultBlackfridayExtensions),
+	).Parse(markdown)
+
+	blocks := []CodeBlock{}
+
+	document.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		if node.Type != bf.CodeBlock || !node.IsFenced {
+			return bf.GoToNext
+		}
+
+		info := ParseInfoString(string(node.Info))
+
+		blocks = append(blocks, CodeBlock{
+			Language:    info.Language,
+			Title:       info.Title,
+			Theme:       info.Theme,
+			Collapse:    info.Collapse,
+			LineNumbers: info.LineNumbers,
+			Content:     strings.TrimSuffix(string(node.Literal), "\n"),
+		})
+
+		return bf.GoToNext
+	})
+
+	return blocks
+}
+
+// wrapLines splits lines longer than cols characters into several ones.
+func wrapLines(text string, cols int) string {
+	if cols <= 0 {
+		return text
+	}
+
+	lines := strings.Split(text, "\n")
+
+	wrapped := make([]string, 0, len(lines))
+	for _, line := range lines {
+		runes := []rune(line)
+
+		for len(runes) > cols {
+			wrapped = append(wrapped, string(runes[:cols]))
+			runes = runes[cols:]
+		}
+
+		wrapped = append(wrapped, string(runes))
+	}
+
+	return strings.Join(wrapped, "\n")
+}
+
+var (
+	rePreformatted = regexp.MustCompile(
+		`(?is)^\s*<pre(?:\s[^>]*)?>(.*)</pre>\s*$`,
+	)
+
+	rePreformattedCode = regexp.MustCompile(
+		`(?is)^\s*<code(\s[^>]*)?>(.*)</code>\s*$`,
+	)
+
+	// class="language-go" is how most markdown tools mark language of code
+	reCodeLanguageClass = regexp.MustCompile(
+		`(?i)\bclass\s*=\s*["'](?:[^"']*\s)?language-([^\s"']+)`,
+	)
+)
+
+// parsePreformatted returns text of the <pre> HTML block, optionally wrapped
+// into <code>, with HTML entities unescaped, and language given by class of
+// the <code>, if any.
+func parsePreformatted(block string) (string, string, bool) {
+	matches := rePreformatted.FindStringSubmatch(block)
+	if matches == nil || strings.Contains(matches[1], "</pre>") {
+		return "", "", false
+	}
+
+	var language string
+
+	text := matches[1]
+	if code := rePreformattedCode.FindStringSubmatch(text); code != nil {
+		text = code[2]
+
+		if class := reCodeLanguageClass.FindStringSubmatch(code[1]); class != nil {
+			language = class[1]
+		}
+	}
+
+	if strings.Contains(text, "<") {
+		// there is markup inside, which code macro can't keep
+		return "", "", false
+	}
+
+	// newline right after <pre> is not a part of the content in HTML
+	text = strings.TrimPrefix(text, "\n")
+
+	return strings.TrimSuffix(html.UnescapeString(text), "\n"), language, true
+}
@@ -0,0 +1,111 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractCodeBlocks(t *testing.T) {
+	markdown := text(
+		"# Examples",
+		"",
+		"```go linenumbers",
+		"fmt.Println()",
+		"```",
+		"",
+		"    indented code is not fenced",
+		"",
+		"```bash collapse title=\"Install it\"",
+		"make install",
+		"```",
+		"",
+	)
+
+	assert.Equal(
+		t,
+		[]CodeBlock{
+			{
+				Language:    "go",
+				LineNumbers: true,
+				Content:     "fmt.Println()",
+			},
+			{
+				Language: "bash",
+				Title:    "Install it",
+				Collapse: true,
+				Content:  "make install",
+			},
+		},
+		ExtractCodeBlocks([]byte(markdown)),
+	)
+}
+
+func TestWrapLines(t *testing.T) {
+	test := assert.New(t)
+
+	test.Equal("abcdef\nxy", wrapLines("abcdef\nxy", 0))
+	test.Equal("abc\ndef\nxy", wrapLines("abcdef\nxy", 3))
+	test.Equal("абв\nгд", wrapLines("абвгд", 3))
+}
+
+func TestCompileMarkdown_PageWidth(t *testing.T) {
+	assert.Contains(
+		t,
+		compile(text("```go", "fmt.Println()", "```"), WithPageWidth(5)),
+		"<![CDATA[fmt.P\nrintl\nn()]]>",
+	)
+}
+
+func TestCompileMarkdown_PreformattedHTML(t *testing.T) {
+	assert.Equal(
+		t,
+		text(
+			"<p>text</p>",
+			`<ac:structured-macro ac:name="code">`,
+			`<ac:parameter ac:name="language"></ac:parameter>`,
+			`<ac:parameter ac:name="collapse">false</ac:parameter>`,
+			`<ac:parameter ac:name="atlassian-macro-output-type">BLOCK</ac:parameter>`,
+			"<ac:plain-text-body><![CDATA[if a < b {",
+			"    return",
+			"}]]></ac:plain-text-body>",
+			"</ac:structured-macro>",
+			"",
+		),
+		compile(text(
+			"text",
+			"",
+			"<pre>",
+			"if a &lt; b {",
+			"    return",
+			"}",
+			"</pre>",
+			"",
+		)),
+	)
+
+	assert.Contains(
+		t,
+		compile("<pre><b>bold</b></pre>"),
+		"<pre><b>bold</b></pre>",
+	)
+
+	assert.Equal(
+		t,
+		text(
+			`<ac:structured-macro ac:name="code">`,
+			`<ac:parameter ac:name="language">javascript</ac:parameter>`,
+			`<ac:parameter ac:name="collapse">false</ac:parameter>`,
+			`<ac:parameter ac:name="atlassian-macro-output-type">BLOCK</ac:parameter>`,
+			"<ac:plain-text-body><![CDATA[a && b]]></ac:plain-text-body>",
+			"</ac:structured-macro>",
+			"",
+		),
+		compile(text(
+			`<pre>`,
+			`<code class="hljs language-js">a &amp;&amp; b</code>`,
+			`</pre>`,
+			"",
+		)),
+	)
+}
@@ -0,0 +1,38 @@
+package mark
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// CDATA sections are matched along with comments only to skip them, since
+// comment-like text inside of code blocks must be kept as is.
+var reHTMLComment = regexp.MustCompile(`(?s)<!\[CDATA\[.*?\]\]>|<!--(.*?)-->`)
+
+// processComments removes HTML comments from the rendered page if strip is
+// set, otherwise it rewrites comments so they are valid XML comments:
+// Confluence Storage Format rejects comments containing `--` or ending
+// with `-`.
+func processComments(html []byte, strip bool) []byte {
+	return reHTMLComment.ReplaceAllFunc(html, func(match []byte) []byte {
+		if !bytes.HasPrefix(match, []byte("<!--")) {
+			return match
+		}
+
+		if strip {
+			return nil
+		}
+
+		comment := match[4 : len(match)-3]
+
+		for bytes.Contains(comment, []byte("--")) {
+			comment = bytes.ReplaceAll(comment, []byte("--"), []byte("- -"))
+		}
+
+		if bytes.HasSuffix(comment, []byte("-")) {
+			comment = append(comment, ' ')
+		}
+
+		return []byte("<!--" + string(comment) + "-->")
+	})
+}
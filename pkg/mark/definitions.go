@@ -0,0 +1,70 @@
+package mark
+
+import (
+	"io"
+
+	bf "github.com/kovetskiy/blackfriday/v2"
+)
+
+// isDefinitionList reports whether the node is a definition list produced
+// by DefinitionLists extension.
+func isDefinitionList(node *bf.Node) bool {
+	return node != nil &&
+		node.Type == bf.List &&
+		node.ListFlags&bf.ListTypeDefinition != 0
+}
+
+// isTerm reports whether the item of definition list is a term.
+func isTerm(node *bf.Node) bool {
+	return node != nil && node.ListFlags&bf.ListTypeTerm != 0
+}
+
+// renderDefinitionList renders definition list as two-column table, since
+// Confluence doesn't support <dl>. Every term gets its own row and all of
+// its definitions are put into the second cell of the row.
+func (renderer *ConfluenceRenderer) renderDefinitionList(
+	writer io.Writer,
+	node *bf.Node,
+	entering bool,
+) {
+	switch node.Type {
+	case bf.List:
+		if entering {
+			io.WriteString(writer, "<table>\n<tbody>\n")
+		} else {
+			io.WriteString(writer, "</tbody>\n</table>\n")
+		}
+
+	case bf.Item:
+		if isTerm(node) {
+			if entering {
+				io.WriteString(writer, "<tr>\n<th>")
+
+				return
+			}
+
+			io.WriteString(writer, "</th>\n")
+
+			// term without definitions still gets empty second cell
+			if node.Next == nil || isTerm(node.Next) {
+				io.WriteString(writer, "<td></td>\n</tr>\n")
+			}
+
+			return
+		}
+
+		if entering {
+			if isTerm(node.Prev) || node.Prev == nil {
+				io.WriteString(writer, "<td>")
+			} else {
+				io.WriteString(writer, "<br/>")
+			}
+
+			return
+		}
+
+		if node.Next == nil || isTerm(node.Next) {
+			io.WriteString(writer, "</td>\n</tr>\n")
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package mark
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/reconquest/pkg/log"
+)
+
+var (
+	reFencedCode = regexp.MustCompile(
+		"(?ms)^[ \t]*```.*?^[ \t]*```[ \t]*$|^[ \t]*~~~.*?^[ \t]*~~~[ \t]*$",
+	)
+
+	reRecentlyUpdatedDashboard = regexp.MustCompile(
+		`(?m)^[ \t]*\[RECENTLY-UPDATED-DASHBOARD(\s[^\]\n]*)?\][ \t]*$`,
+	)
+
+	reTOC = regexp.MustCompile(`(?m)^[ \t]*\[TOC\][ \t]*$`)
+
+	reTOCZoneOpen = regexp.MustCompile(
+		`(?m)^[ \t]*\[TOC-ZONE(\s[^\]\n]*)?\][ \t]*$`,
+	)
+
+	reTOCZoneClose = regexp.MustCompile(`(?m)^[ \t]*\[/TOC-ZONE\][ \t]*$`)
+
+	reTabOpen  = regexp.MustCompile("^[ \t]*```tab(\\s[^\n]*)?$")
+	reTabClose = regexp.MustCompile("^[ \t]*```/tab[ \t]*$")
+	reFence    = regexp.MustCompile("^[ \t]*(```|~~~)")
+)
+
+// recentlyUpdatedDashboardParams lists parameters which can be given to
+// [RECENTLY-UPDATED-DASHBOARD] directive.
+var recentlyUpdatedDashboardParams = map[string]bool{
+	"theme":        true,
+	"remoteSpaces": true,
+	"spaces":       true,
+	"types":        true,
+}
+
+// tocZoneParams lists parameters which can be given to [TOC-ZONE]
+// directive.
+var tocZoneParams = map[string]bool{
+	"location": true,
+	"maxLevel": true,
+	"minLevel": true,
+	"type":     true,
+	"outline":  true,
+	"style":    true,
+	"exclude":  true,
+	"include":  true,
+}
+
+// tabParams lists parameters which can be given to ```tab directive.
+var tabParams = map[string]bool{
+	"title": true,
+}
+
+// replaceOutsideCode works like regexp.ReplaceAllFunc, but leaves fenced
+// code blocks untouched, so directives can be shown in code examples.
+func replaceOutsideCode(
+	markdown []byte,
+	re *regexp.Regexp,
+	replace func([]byte) []byte,
+) []byte {
+	var (
+		result []byte
+		last   int
+	)
+
+	for _, block := range reFencedCode.FindAllIndex(markdown, -1) {
+		result = append(
+			result,
+			re.ReplaceAllFunc(markdown[last:block[0]], replace)...,
+		)
+		result = append(result, markdown[block[0]:block[1]]...)
+
+		last = block[1]
+	}
+
+	return append(result, re.ReplaceAllFunc(markdown[last:], replace)...)
+}
+
+// parseDirectiveParams parses `key=value` pairs given to directive,
+// values might be double quoted.
+func parseDirectiveParams(
+	directive string,
+	raw string,
+	known map[string]bool,
+) map[string]string {
+	params := map[string]string{}
+
+	for _, param := range splitExceptOnQuotes(raw) {
+		index := strings.Index(param, "=")
+		if index < 0 || !known[param[:index]] {
+			log.Warningf(
+				nil,
+				"unknown parameter %q of %s directive is ignored",
+				param,
+				directive,
+			)
+
+			continue
+		}
+
+		params[param[:index]] = html.EscapeString(unquote(param[index+1:]))
+	}
+
+	return params
+}
+
+// processDirectives replaces directives like [RECENTLY-UPDATED-DASHBOARD]
+// given on their own lines with Confluence macros.
+func (renderer *ConfluenceRenderer) processDirectives(markdown []byte) []byte {
+	// tabs go first, since they look like fenced code blocks
+	markdown = renderer.processTabs(markdown)
+
+	markdown = replaceOutsideCode(
+		markdown,
+		reRecentlyUpdatedDashboard,
+		func(match []byte) []byte {
+			groups := reRecentlyUpdatedDashboard.FindSubmatch(match)
+
+			return renderer.renderDirective(
+				match,
+				"ac:recently-updated-dashboard",
+				struct {
+					Params map[string]string
+				}{
+					parseDirectiveParams(
+						"RECENTLY-UPDATED-DASHBOARD",
+						string(groups[1]),
+						recentlyUpdatedDashboardParams,
+					),
+				},
+			)
+		},
+	)
+
+	// [TOC] is used by Python-Markdown and MkDocs for table of contents
+	markdown = replaceOutsideCode(
+		markdown,
+		reTOC,
+		func(match []byte) []byte {
+			return renderer.renderDirective(
+				match,
+				"ac:toc",
+				map[string]string{},
+			)
+		},
+	)
+
+	// [TOC-ZONE] and [/TOC-ZONE] are replaced separately, so markdown
+	// between them, including code blocks, is rendered as usual
+	opened := 0
+
+	markdown = replaceOutsideCode(
+		markdown,
+		reTOCZoneOpen,
+		func(match []byte) []byte {
+			groups := reTOCZoneOpen.FindSubmatch(match)
+
+			opened++
+
+			return renderer.renderDirective(
+				match,
+				"ac:toc-zone:open",
+				struct {
+					Params map[string]string
+				}{
+					parseDirectiveParams(
+						"TOC-ZONE",
+						string(groups[1]),
+						tocZoneParams,
+					),
+				},
+			)
+		},
+	)
+
+	markdown = replaceOutsideCode(
+		markdown,
+		reTOCZoneClose,
+		func(match []byte) []byte {
+			opened--
+
+			return renderer.renderDirective(match, "ac:toc-zone:close", nil)
+		},
+	)
+
+	if opened != 0 {
+		log.Warningf(
+			nil,
+			"[TOC-ZONE] and [/TOC-ZONE] directives are not paired",
+		)
+	}
+
+	return markdown
+}
+
+// renderDirective renders directive using given template or leaves it as is
+// if template fails.
+func (renderer *ConfluenceRenderer) renderDirective(
+	match []byte,
+	template string,
+	data interface{},
+) []byte {
+	var buffer bytes.Buffer
+
+	err := renderer.Stdlib.Templates.ExecuteTemplate(&buffer, template, data)
+	if err != nil {
+		log.Errorf(err, "unable to render %s", match)
+
+		return match
+	}
+
+	return buffer.Bytes()
+}
+
+// processTabs replaces ```tab title="..." and ```/tab directives with tab
+// macros; adjacent tabs are wrapped into single tabs macro.
+func (renderer *ConfluenceRenderer) processTabs(markdown []byte) []byte {
+	lines := bytes.Split(markdown, []byte("\n"))
+
+	var (
+		result [][]byte
+		fence  []byte
+		inTab  bool
+		inTabs bool
+	)
+
+	for i, line := range lines {
+		if fence != nil {
+			// closing fence has no info string
+			closing := bytes.TrimSpace(line)
+			if bytes.HasPrefix(closing, fence) &&
+				len(bytes.Trim(closing, string(fence[:1]))) == 0 {
+				fence = nil
+			}
+
+			result = append(result, line)
+
+			continue
+		}
+
+		if groups := reTabOpen.FindSubmatch(line); groups != nil {
+			if inTab {
+				log.Warningf(nil, "nested ```tab directives are not supported")
+
+				result = append(result, line)
+
+				continue
+			}
+
+			if !inTabs {
+				result = append(
+					result,
+					nil,
+					renderer.renderDirective(line, "ac:tabs:open", nil),
+					nil,
+				)
+			}
+
+			result = append(
+				result,
+				renderer.renderDirective(
+					line,
+					"ac:tab:open",
+					struct {
+						Params map[string]string
+					}{
+						parseDirectiveParams("tab", string(groups[1]), tabParams),
+					},
+				),
+				nil,
+			)
+
+			inTab = true
+			inTabs = true
+
+			continue
+		}
+
+		if reTabClose.Match(line) && inTab {
+			result = append(
+				result,
+				nil,
+				renderer.renderDirective(line, "ac:tab:close", nil),
+				nil,
+			)
+
+			inTab = false
+
+			if !isNextTab(lines[i+1:]) {
+				result = append(
+					result,
+					renderer.renderDirective(line, "ac:tabs:close", nil),
+					nil,
+				)
+
+				inTabs = false
+			}
+
+			continue
+		}
+
+		if groups := reFence.FindSubmatch(line); groups != nil {
+			fence = groups[1]
+		}
+
+		result = append(result, line)
+	}
+
+	if inTab {
+		log.Warningf(nil, "```tab directive is not closed with ```/tab")
+	}
+
+	return bytes.Join(result, []byte("\n"))
+}
+
+// isNextTab reports whether the next non-empty line opens a tab.
+func isNextTab(lines [][]byte) bool {
+	for _, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		return reTabOpen.Match(line)
+	}
+
+	return false
+}
@@ -0,0 +1,190 @@
+package mark
+
+import (
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	bf "github.com/kovetskiy/blackfriday/v2"
+	"github.com/reconquest/pkg/log"
+)
+
+// EmoticonFallbackStrategy defines what to do with emoji shortcode which has
+// no Confluence emoticon equivalent.
+type EmoticonFallbackStrategy int
+
+const (
+	// FallbackKeepText leaves shortcode as is.
+	FallbackKeepText EmoticonFallbackStrategy = iota
+
+	// FallbackUseUnicode replaces shortcode with Unicode emoji if it's known,
+	// otherwise shortcode is left as is.
+	FallbackUseUnicode
+
+	// FallbackWarn leaves shortcode as is and logs a warning.
+	FallbackWarn
+)
+
+// variationSelector may follow emoji to request emoji-style presentation.
+const variationSelector = "\uFE0F"
+
+// Emoticons maps emoji shortcodes to names of Confluence emoticons.
+// See Confluence docs on "Symbols, Emoticons and Special Characters".
+var Emoticons = map[string]string{
+	":smile:":                 "smile",
+	":slightly_smiling_face:": "smile",
+	":disappointed:":          "sad",
+	":stuck_out_tongue:":      "cheeky",
+	":laughing:":              "laugh",
+	":wink:":                  "wink",
+	":+1:":                    "thumbs-up",
+	":thumbsup:":              "thumbs-up",
+	":-1:":                    "thumbs-down",
+	":thumbsdown:":            "thumbs-down",
+	":information_source:":    "information",
+	":tick:":                  "tick",
+	":heavy_check_mark:":      "tick",
+	":white_check_mark:":      "tick",
+	":cross:":                 "cross",
+	":x:":                     "cross",
+	":warning:":               "warning",
+	":heavy_plus_sign:":       "plus",
+	":heavy_minus_sign:":      "minus",
+	":question:":              "question",
+	":bulb:":                  "light-on",
+	":star:":                  "yellow-star",
+	":heart:":                 "heart",
+	":broken_heart:":          "broken-heart",
+}
+
+// UnicodeEmoticons maps Unicode emoji to names of Confluence emoticons.
+var UnicodeEmoticons = map[string]string{
+	"\u263A":     "smile",
+	"\U0001F642": "smile",
+	"\U0001F61E": "sad",
+	"\U0001F61B": "cheeky",
+	"\U0001F606": "laugh",
+	"\U0001F609": "wink",
+	"\U0001F44D": "thumbs-up",
+	"\U0001F44E": "thumbs-down",
+	"\u2139":     "information",
+	"\u2714":     "tick",
+	"\u2705":     "tick",
+	"\u2716":     "cross",
+	"\u274C":     "cross",
+	"\u26A0":     "warning",
+	"\u2795":     "plus",
+	"\u2796":     "minus",
+	"\u2753":     "question",
+	"\U0001F4A1": "light-on",
+	"\u2B50":     "yellow-star",
+	"\u2764":     "heart",
+	"\U0001F494": "broken-heart",
+}
+
+var reEmoticon = compileEmoticonRegexp()
+
+// compileEmoticonRegexp builds regexp which matches any shortcode and any
+// emoji from UnicodeEmoticons.
+func compileEmoticonRegexp() *regexp.Regexp {
+	emoji := []string{}
+	for char := range UnicodeEmoticons {
+		emoji = append(emoji, regexp.QuoteMeta(char))
+	}
+
+	sort.Strings(emoji)
+
+	return regexp.MustCompile(
+		`:[a-z0-9_+\-]+:|(?:` + strings.Join(emoji, "|") + `)` +
+			variationSelector + `?`,
+	)
+}
+
+// EmojiUnicode maps emoji shortcodes which have no Confluence emoticon to
+// Unicode emoji, used by FallbackUseUnicode strategy.
+var EmojiUnicode = map[string]string{
+	":rocket:":       "\U0001F680",
+	":tada:":         "\U0001F389",
+	":fire:":         "\U0001F525",
+	":eyes:":         "\U0001F440",
+	":100:":          "\U0001F4AF",
+	":sparkles:":     "✨",
+	":bug:":          "\U0001F41B",
+	":memo:":         "\U0001F4DD",
+	":construction:": "\U0001F6A7",
+	":lock:":         "\U0001F512",
+}
+
+// WithEmoticonMapping replaces emoji shortcodes like `:smile:` and Unicode
+// emoji like ✔ in text with Confluence emoticons, since raw UTF-8 emoji are
+// broken on older Confluence instances.
+func WithEmoticonMapping() RendererOption {
+	return func(renderer *ConfluenceRenderer) {
+		renderer.emoticons = true
+	}
+}
+
+// WithEmoticonFallback sets what to do with shortcodes which are not in
+// Emoticons when WithEmoticonMapping is enabled.
+func WithEmoticonFallback(strategy EmoticonFallbackStrategy) RendererOption {
+	return func(renderer *ConfluenceRenderer) {
+		renderer.emoticonFallback = strategy
+	}
+}
+
+// renderEmoticons writes text node replacing emoji shortcodes with
+// Confluence emoticons; the rest of text is rendered as usual.
+func (renderer *ConfluenceRenderer) renderEmoticons(
+	writer io.Writer,
+	node *bf.Node,
+	entering bool,
+) {
+	literal := node.Literal
+
+	last := 0
+	for _, match := range reEmoticon.FindAllIndex(literal, -1) {
+		shortcode := string(literal[match[0]:match[1]])
+
+		name, ok := Emoticons[shortcode]
+		if !ok {
+			name, ok = UnicodeEmoticons[strings.TrimSuffix(
+				shortcode,
+				variationSelector,
+			)]
+		}
+
+		if !ok {
+			switch renderer.emoticonFallback {
+			case FallbackUseUnicode:
+				if emoji, ok := EmojiUnicode[shortcode]; ok {
+					renderer.renderText(writer, node, literal[last:match[0]], entering)
+					io.WriteString(writer, emoji)
+
+					last = match[1]
+				}
+
+			case FallbackWarn:
+				log.Warningf(nil, "unknown emoji shortcode: %s", shortcode)
+			}
+
+			continue
+		}
+
+		renderer.renderText(writer, node, literal[last:match[0]], entering)
+
+		renderer.Stdlib.Templates.ExecuteTemplate(
+			writer,
+			"ac:emoticon",
+			struct {
+				Name string
+			}{
+				name,
+			},
+		)
+
+		last = match[1]
+	}
+
+	renderer.renderText(writer, node, literal[last:], entering)
+}
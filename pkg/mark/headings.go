@@ -0,0 +1,269 @@
+package mark
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	bf "github.com/kovetskiy/blackfriday/v2"
+	"github.com/reconquest/pkg/log"
+)
+
+// reATXHeading matches ATX heading line like `## Heading`.
+var reATXHeading = regexp.MustCompile(`(?m)^( {0,3})(#{1,6})([ \t][^\n]*)?$`)
+
+// reHeadingAttributes matches ATX heading with Pandoc-style attributes like
+// `## Heading {.warning #anchor}`, capturing heading and attributes.
+var reHeadingAttributes = regexp.MustCompile(
+	`(?m)^( {0,3}#{1,6}[ \t]+[^\n]*?)[ \t]+\{([^{}\n]*)\}[ \t]*$`,
+)
+
+// reHeadingAttribute matches single attribute: .class, #id or key=value.
+var reHeadingAttribute = regexp.MustCompile(
+	`^(?:\.([\w-]+)|#([\w-]+)|[\w-]+=(?:"[^"]*"|\S*))$`,
+)
+
+// headingClassMacros maps classes of headings to macros the heading is
+// wrapped into.
+var headingClassMacros = map[string]string{
+	"info":    "info",
+	"note":    "note",
+	"tip":     "tip",
+	"warning": "warning",
+}
+
+// Heading is a heading of the document along with headings of its section;
+// ID is the id the heading is given when rendered, which can be used in
+// links to the heading.
+type Heading struct {
+	Level    int
+	Text     string
+	ID       string
+	Children []Heading
+}
+
+// WithMinHeadingLevel normalizes heading levels by NormalizeHeadingLevels
+// and shifts them so top-level headings are of given level, e.g. 2 renders
+// `#` as <h2>; 0 keeps level of the top-level headings as is.
+func WithMinHeadingLevel(level int) RendererOption {
+	return func(renderer *ConfluenceRenderer) {
+		renderer.normalizeHeadings = true
+		renderer.minHeadingLevel = level
+	}
+}
+
+// NormalizeHeadingLevels promotes headings so that no level is skipped, e.g.
+// H1 followed by H3 becomes H1 followed by H2. Level of the top-level
+// headings is kept.
+func NormalizeHeadingLevels(markdown []byte) []byte {
+	return normalizeHeadingLevels(markdown, 0)
+}
+
+// normalizeHeadingLevels works like NormalizeHeadingLevels, but sets level
+// of top-level headings to minLevel unless it's 0.
+func normalizeHeadingLevels(markdown []byte, minLevel int) []byte {
+	if minLevel == 0 {
+		minLevel = 6
+
+		replaceOutsideCode(
+			markdown,
+			reATXHeading,
+			func(match []byte) []byte {
+				level := len(reATXHeading.FindSubmatch(match)[2])
+				if level < minLevel {
+					minLevel = level
+				}
+
+				return match
+			},
+		)
+	}
+
+	type heading struct {
+		level      int
+		normalized int
+	}
+
+	var parents []heading
+
+	return replaceOutsideCode(
+		markdown,
+		reATXHeading,
+		func(match []byte) []byte {
+			groups := reATXHeading.FindSubmatch(match)
+
+			level := len(groups[2])
+
+			for len(parents) > 0 && parents[len(parents)-1].level >= level {
+				parents = parents[:len(parents)-1]
+			}
+
+			normalized := minLevel
+			if len(parents) > 0 {
+				normalized = parents[len(parents)-1].normalized + 1
+			}
+
+			if normalized > 6 {
+				normalized = 6
+			}
+
+			parents = append(parents, heading{level, normalized})
+
+			result := append([]byte{}, groups[1]...)
+			result = append(result, bytes.Repeat([]byte("#"), normalized)...)
+
+			return append(result, groups[3]...)
+		},
+	)
+}
+
+// processHeadingAttributes strips Pandoc-style attributes from headings.
+// Id is kept as `{#id}`, so it's rendered as anchor; heading with class
+// listed in headingClassMacros is wrapped into corresponding macro. Braces
+// which don't consist of attributes are left as a part of the heading.
+func (renderer *ConfluenceRenderer) processHeadingAttributes(
+	markdown []byte,
+) []byte {
+	return replaceOutsideCode(
+		markdown,
+		reHeadingAttributes,
+		func(match []byte) []byte {
+			groups := reHeadingAttributes.FindSubmatch(match)
+
+			var id, macro string
+
+			for _, attribute := range strings.Fields(string(groups[2])) {
+				parts := reHeadingAttribute.FindStringSubmatch(attribute)
+				if parts == nil {
+					return match
+				}
+
+				switch {
+				case parts[1] != "":
+					if name, ok := headingClassMacros[parts[1]]; ok {
+						if macro == "" {
+							macro = name
+						}
+					} else {
+						log.Debugf(
+							nil,
+							"heading class %q has no corresponding macro",
+							parts[1],
+						)
+					}
+
+				case parts[2] != "":
+					id = parts[2]
+				}
+			}
+
+			heading := append([]byte{}, groups[1]...)
+			if id != "" {
+				heading = append(heading, " {#"+id+"}"...)
+			}
+
+			if macro == "" {
+				return heading
+			}
+
+			var buffer bytes.Buffer
+
+			buffer.Write(
+				renderer.renderDirective(
+					match,
+					"ac:box:open",
+					struct {
+						Name string
+						Icon string
+					}{
+						Name: macro,
+					},
+				),
+			)
+			buffer.WriteString("\n\n")
+			buffer.Write(heading)
+			buffer.WriteString("\n\n")
+			buffer.Write(renderer.renderDirective(match, "ac:box:close", nil))
+
+			return buffer.Bytes()
+		},
+	)
+}
+
+// ExtractHeadings returns tree of the document headings without rendering
+// it: every heading holds headings of lower levels which follow it until
+// heading of the same or higher level.
+func ExtractHeadings(markdown []byte) []Heading {
+	document := bf.New(
+		bf.WithExtensions(DefaultBlackfridayExtensions),
+	).Parse(markdown)
+
+	headings := []Heading{}
+	ids := map[string]int{}
+
+	document.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		if node.Type != bf.Heading || !entering || node.IsTitleblock {
+			return bf.GoToNext
+		}
+
+		headings = append(headings, Heading{
+			Level: node.Level,
+			Text:  nodeText(node),
+			ID:    uniqueHeadingID(ids, node.HeadingID),
+		})
+
+		return bf.SkipChildren
+	})
+
+	return nestHeadings(headings)
+}
+
+// nestHeadings puts every heading of the flat list into Children of the
+// closest preceding heading of higher level.
+func nestHeadings(headings []Heading) []Heading {
+	tree := []Heading{}
+
+	for i := 0; i < len(headings); {
+		heading := headings[i]
+
+		end := i + 1
+		for end < len(headings) && headings[end].Level > heading.Level {
+			end++
+		}
+
+		if end > i+1 {
+			heading.Children = nestHeadings(headings[i+1 : end])
+		}
+
+		tree = append(tree, heading)
+
+		i = end
+	}
+
+	return tree
+}
+
+// uniqueHeadingID returns id suffixed with a number if it's already used,
+// e.g. the second `# Intro` heading gets intro-1, the same way as markdown
+// renderer does it; ids holds ids used so far.
+func uniqueHeadingID(ids map[string]int, id string) string {
+	if id == "" {
+		return id
+	}
+
+	for count, found := ids[id]; found; count, found = ids[id] {
+		suffixed := fmt.Sprintf("%s-%d", id, count+1)
+
+		if _, used := ids[suffixed]; !used {
+			ids[id] = count + 1
+			id = suffixed
+		} else {
+			id = id + "-1"
+		}
+	}
+
+	ids[id] = 0
+
+	return id
+}
@@ -0,0 +1,128 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeHeadingLevels(t *testing.T) {
+	assert.Equal(
+		t,
+		text(
+			"## Title",
+			"### Skipped",
+			"#### Deep",
+			"### Back",
+			"## Next ##",
+			"",
+			"```",
+			"##### Code",
+			"```",
+			"#hashtag",
+		),
+		string(NormalizeHeadingLevels([]byte(text(
+			"## Title",
+			"#### Skipped",
+			"###### Deep",
+			"#### Back",
+			"## Next ##",
+			"",
+			"```",
+			"##### Code",
+			"```",
+			"#hashtag",
+		)))),
+	)
+}
+
+func TestCompileMarkdown_MinHeadingLevel(t *testing.T) {
+	markdown := text(
+		"# Title",
+		"",
+		"### Section",
+		"",
+		"Text",
+	)
+
+	assert.Equal(
+		t,
+		text(
+			`<ac:structured-macro ac:name="anchor"><ac:parameter ac:name="">title</ac:parameter></ac:structured-macro>`,
+			`<h2>Title</h2>`,
+			"",
+			`<ac:structured-macro ac:name="anchor"><ac:parameter ac:name="">section</ac:parameter></ac:structured-macro>`,
+			`<h3>Section</h3>`,
+			"",
+			"<p>Text</p>",
+			"",
+		),
+		compile(markdown, WithMinHeadingLevel(2)),
+	)
+
+	assert.Equal(
+		t,
+		text(
+			`<ac:structured-macro ac:name="anchor"><ac:parameter ac:name="">title</ac:parameter></ac:structured-macro>`,
+			`<h1>Title</h1>`,
+			"",
+			`<ac:structured-macro ac:name="anchor"><ac:parameter ac:name="">section</ac:parameter></ac:structured-macro>`,
+			`<h2>Section</h2>`,
+			"",
+			"<p>Text</p>",
+			"",
+		),
+		compile(markdown, WithMinHeadingLevel(0)),
+	)
+}
+
+func TestExtractHeadings(t *testing.T) {
+	assert.Equal(
+		t,
+		[]Heading{
+			{
+				Level: 1,
+				Text:  "Title",
+				ID:    "title",
+				Children: []Heading{
+					{
+						Level: 2,
+						Text:  "Install",
+						ID:    "install",
+						Children: []Heading{
+							{Level: 4, Text: "From source", ID: "from-source"},
+						},
+					},
+					{Level: 2, Text: "Usage", ID: "custom"},
+				},
+			},
+			{Level: 1, Text: "Appendix", ID: "appendix"},
+		},
+		ExtractHeadings([]byte(text(
+			"# Title",
+			"",
+			"## Install",
+			"",
+			"#### From `source`",
+			"",
+			"```",
+			"## Code",
+			"```",
+			"",
+			"## Usage {#custom}",
+			"",
+			"# Appendix",
+		))),
+	)
+
+	assert.Equal(
+		t,
+		[]Heading{
+			{Level: 1, Text: "Intro", ID: "intro"},
+			{Level: 1, Text: "Intro", ID: "intro-1"},
+		},
+		ExtractHeadings([]byte(text("# Intro", "", "# Intro"))),
+	)
+
+	assert.Empty(t, ExtractHeadings([]byte("No headings.")))
+}
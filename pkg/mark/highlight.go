@@ -0,0 +1,42 @@
+package mark
+
+import (
+	"regexp"
+)
+
+// reHighlight matches ==highlighted text==; inline code spans, link
+// destinations, autolinks and raw HTML tags are matched too, so they are left
+// as is. Highlighted text can't start or end with space, so comparisons like
+// `a == b` are not matched.
+var reHighlight = regexp.MustCompile(
+	"`[^`\n]*`" +
+		`|\]\([^)\n]*\)` +
+		`|</?[A-Za-z][^<>\n]*>` +
+		`|\b[A-Za-z][A-Za-z0-9+.-]*://[^\s<>]*` +
+		`|==([^=\s](?:[^=\n]*[^=\s])?)==`,
+)
+
+// processHighlights replaces ==highlighted text== with highlight macro;
+// text inside of it is rendered as markdown.
+func (renderer *ConfluenceRenderer) processHighlights(markdown []byte) []byte {
+	return replaceOutsideCode(
+		markdown,
+		reHighlight,
+		func(match []byte) []byte {
+			groups := reHighlight.FindSubmatch(match)
+			if groups[1] == nil {
+				return match
+			}
+
+			return renderer.renderDirective(
+				match,
+				"ac:highlight",
+				struct {
+					Body string
+				}{
+					string(groups[1]),
+				},
+			)
+		},
+	)
+}
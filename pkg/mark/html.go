@@ -0,0 +1,211 @@
+package mark
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/reconquest/pkg/log"
+)
+
+// reHTMLTag matches opening tags of HTML elements, capturing element name.
+var reHTMLTag = regexp.MustCompile(`<([a-zA-Z][a-zA-Z0-9:-]*)`)
+
+// reKbdTag matches opening or closing <kbd> tag, capturing slash of the
+// closing one.
+var reKbdTag = regexp.MustCompile(`(?i)^<(/?)kbd(?:\s[^>]*)?>$`)
+
+// reHTMLSpanTag matches single tag of inline HTML, capturing slash of the
+// closing tag, element name and attributes.
+var reHTMLSpanTag = regexp.MustCompile(
+	`^<(/?)([a-zA-Z][a-zA-Z0-9:-]*)((?:\s[^>]*?)?)\s*(/?)>$`,
+)
+
+// reHTMLAttribute matches attribute of HTML tag, capturing its name.
+var reHTMLAttribute = regexp.MustCompile(
+	`([^\s"'>/=]+)(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?`,
+)
+
+// htmlElements lists HTML elements which are accepted by Confluence Storage
+// Format; elements of ac:, ri: and at: namespaces are accepted as well.
+var htmlElements = map[string]bool{
+	"a":          true,
+	"b":          true,
+	"blockquote": true,
+	"br":         true,
+	"caption":    true,
+	"code":       true,
+	"col":        true,
+	"colgroup":   true,
+	"del":        true,
+	"details":    true,
+	"div":        true,
+	"em":         true,
+	"h1":         true,
+	"h2":         true,
+	"h3":         true,
+	"h4":         true,
+	"h5":         true,
+	"h6":         true,
+	"hr":         true,
+	"i":          true,
+	"img":        true,
+	"li":         true,
+	"ol":         true,
+	"p":          true,
+	"pre":        true,
+	"s":          true,
+	"span":       true,
+	"strong":     true,
+	"sub":        true,
+	"summary":    true,
+	"sup":        true,
+	"table":      true,
+	"tbody":      true,
+	"td":         true,
+	"tfoot":      true,
+	"th":         true,
+	"thead":      true,
+	"time":       true,
+	"tr":         true,
+	"u":          true,
+	"ul":         true,
+}
+
+// WithStrictHTMLValidation reports HTML elements unknown to Confluence
+// found in raw HTML blocks as errors instead of warnings;
+// CompileMarkdownWithError fails if there are any.
+func WithStrictHTMLValidation() RendererOption {
+	return func(renderer *ConfluenceRenderer) {
+		renderer.strictHTML = true
+	}
+}
+
+// unknownHTMLElements returns names of elements used in given HTML which
+// are not accepted by Confluence Storage Format.
+func unknownHTMLElements(html []byte) []string {
+	var unknown []string
+
+	for _, match := range reHTMLTag.FindAllSubmatch(html, -1) {
+		name := strings.ToLower(string(match[1]))
+
+		// colons of namespaced tags are escaped while markdown is rendered
+		if htmlElements[name] ||
+			strings.HasPrefix(name, "ac:") ||
+			strings.HasPrefix(name, "ri:") ||
+			strings.HasPrefix(name, "at:") ||
+			strings.Contains(name, strings.ToLower(colonPlaceholder)) {
+			continue
+		}
+
+		unknown = append(unknown, name)
+	}
+
+	return unknown
+}
+
+// validateHTMLBlock logs every element of raw HTML block which is not
+// accepted by Confluence Storage Format.
+func (renderer *ConfluenceRenderer) validateHTMLBlock(html []byte) {
+	for _, name := range unknownHTMLElements(html) {
+		if renderer.strictHTML {
+			log.Errorf(
+				nil,
+				"HTML element <%s> is not supported by Confluence",
+				name,
+			)
+
+			renderer.unsupportedHTML = append(renderer.unsupportedHTML, name)
+		} else {
+			log.Warningf(
+				nil,
+				"HTML element <%s> is not supported by Confluence",
+				name,
+			)
+		}
+	}
+}
+
+// replaceKbdTag returns replacement for <kbd> tag of inline HTML, since
+// Confluence doesn't support <kbd>; keys are rendered as bold code instead,
+// which looks close to keyboard keys.
+func replaceKbdTag(tag []byte) ([]byte, bool) {
+	groups := reKbdTag.FindSubmatch(bytes.TrimSpace(tag))
+	if groups == nil {
+		return nil, false
+	}
+
+	if len(groups[1]) > 0 {
+		return []byte(`</code></strong>`), true
+	}
+
+	return []byte(`<strong><code>`), true
+}
+
+// isDisallowedHTMLAttribute reports whether attribute is rejected by
+// Confluence Storage Format.
+func isDisallowedHTMLAttribute(name string) bool {
+	name = strings.ToLower(name)
+
+	return name == "style" || name == "class" || strings.HasPrefix(name, "data-")
+}
+
+// sanitizeHTMLSpan strips attributes which Confluence rejects from tag of
+// inline HTML and removes tags of elements unknown to Confluence, keeping
+// text inside of them. Namespaced tags like <ac:...>, comments and spans
+// which set text color only, since they are converted into color macro
+// later, are returned as is.
+func sanitizeHTMLSpan(tag []byte) []byte {
+	groups := reHTMLSpanTag.FindSubmatch(bytes.TrimSpace(tag))
+	if groups == nil ||
+		bytes.Contains(groups[2], []byte(":")) ||
+		bytes.Contains(groups[2], []byte(colonPlaceholder)) ||
+		reColoredSpan.MatchString(string(tag)+"</span>") {
+		return tag
+	}
+
+	name := strings.ToLower(string(groups[2]))
+
+	if !htmlElements[name] {
+		if len(groups[1]) == 0 {
+			log.Warningf(
+				nil,
+				"HTML element <%s> is not supported by Confluence, removed",
+				name,
+			)
+		}
+
+		return nil
+	}
+
+	result := []byte("<" + string(groups[1]) + string(groups[2]))
+
+	for _, attribute := range reHTMLAttribute.FindAllSubmatch(groups[3], -1) {
+		if isDisallowedHTMLAttribute(string(attribute[1])) {
+			continue
+		}
+
+		result = append(result, ' ')
+		result = append(result, attribute[0]...)
+	}
+
+	if len(groups[4]) > 0 {
+		result = append(result, '/')
+	}
+
+	return append(result, '>')
+}
+
+// htmlError returns error listing unsupported HTML elements found in strict
+// mode, or nil if there are none.
+func (renderer *ConfluenceRenderer) htmlError() error {
+	if len(renderer.unsupportedHTML) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"HTML elements not supported by Confluence: <%s>",
+		strings.Join(renderer.unsupportedHTML, ">, <"),
+	)
+}
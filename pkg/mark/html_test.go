@@ -0,0 +1,83 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/kovetskiy/mark/pkg/mark/stdlib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnknownHTMLElements(t *testing.T) {
+	assert.Equal(
+		t,
+		[]string{"blink", "marquee"},
+		unknownHTMLElements([]byte(
+			`<div class="note"><BLINK>a</BLINK><br/><marquee>b</marquee>`+
+				`<ac:emoticon ac:name="smile"/><!-- comment --></div>`,
+		)),
+	)
+
+	assert.Empty(
+		t,
+		unknownHTMLElements([]byte(`<table><tr><td>a</td></tr></table>`)),
+	)
+
+	assert.Empty(
+		t,
+		unknownHTMLElements([]byte(
+			`<ac---bf-COLON---rich-text-body>a</ac---bf-COLON---rich-text-body>`,
+		)),
+	)
+}
+
+func TestSanitizeHTMLSpan(t *testing.T) {
+	test := assert.New(t)
+
+	test.Equal(
+		`<a href="https://example.com" title='x'>`,
+		string(sanitizeHTMLSpan([]byte(
+			`<a class="link" href="https://example.com" data-id=1 title='x'>`,
+		))),
+	)
+	test.Equal(
+		`<br/>`,
+		string(sanitizeHTMLSpan([]byte(`<br style="clear: both" />`))),
+	)
+	test.Equal(`</span>`, string(sanitizeHTMLSpan([]byte(`</span>`))))
+	test.Empty(sanitizeHTMLSpan([]byte(`<blink>`)))
+	test.Empty(sanitizeHTMLSpan([]byte(`</blink>`)))
+	test.Equal(
+		`<span style="color: red">`,
+		string(sanitizeHTMLSpan([]byte(`<span style="color: red">`))),
+	)
+	test.Equal(
+		`<ac:emoticon ac:name="smile"/>`,
+		string(sanitizeHTMLSpan([]byte(`<ac:emoticon ac:name="smile"/>`))),
+	)
+	test.Equal(`<!-- note -->`, string(sanitizeHTMLSpan([]byte(`<!-- note -->`))))
+}
+
+func TestCompileMarkdownWithError_StrictHTML(t *testing.T) {
+	lib, err := stdlib.New(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	markdown := []byte(text(
+		"<div>",
+		"<blink>a</blink>",
+		"</div>",
+		"",
+	))
+
+	_, err = CompileMarkdownWithError(markdown, lib)
+	assert.NoError(t, err)
+
+	html, err := CompileMarkdownWithError(markdown, lib, WithStrictHTMLValidation())
+	assert.EqualError(
+		t,
+		err,
+		"HTML elements not supported by Confluence: <blink>",
+	)
+	assert.Contains(t, html, "<blink>a</blink>")
+}
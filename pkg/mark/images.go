@@ -0,0 +1,161 @@
+package mark
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/reconquest/pkg/log"
+)
+
+// reImageAttributes matches image link followed by Pandoc-like attribute
+// block, e.g. ![alt](image.png "title"){width=300 height=200}.
+var reImageAttributes = regexp.MustCompile(
+	`(!\[[^\]\n]*\]\()([^)\s]+)(\s+"[^"\n]*")?\)\{([^}\n]*)\}`,
+)
+
+// reImageSizeSuffix matches image link with `=WxH` size suffix after
+// destination, e.g. ![alt](image.png =300x200); either of dimensions might
+// be omitted, like in `=300x` or `=x200`.
+var reImageSizeSuffix = regexp.MustCompile(
+	`(!\[[^\]\n]*\]\()([^)\s]+)\s+=([0-9]*)x([0-9]*)(\s+"[^"\n]*")?\)`,
+)
+
+// WithBaseURL makes relative image sources absolute by resolving them
+// against given URL, which is useful when images are hosted elsewhere
+// instead of being uploaded as attachments.
+func WithBaseURL(base *url.URL) RendererOption {
+	return func(renderer *ConfluenceRenderer) {
+		renderer.baseURL = base
+	}
+}
+
+// resolveImageURL prepends base URL to relative image source; absolute
+// URLs and paths, like ones of attachments, are returned as is.
+func (renderer *ConfluenceRenderer) resolveImageURL(dest string) string {
+	uri, err := url.Parse(dest)
+	if err != nil || uri.Scheme != "" || uri.Host != "" ||
+		strings.HasPrefix(uri.Path, "/") || uri.Path == "" {
+		return dest
+	}
+
+	// base is treated as a directory even without trailing slash
+	base := *renderer.baseURL
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+
+	return base.ResolveReference(uri).String()
+}
+
+// ImageAttributes are sizing hints given to image in attribute block.
+type ImageAttributes struct {
+	Width  string
+	Height string
+}
+
+// ParseImageAttributes parses `{key=value ...}` attribute block; values
+// might be double quoted and `px` unit is optional.
+func ParseImageAttributes(raw string) ImageAttributes {
+	var attributes ImageAttributes
+
+	raw = strings.TrimSuffix(strings.TrimPrefix(raw, "{"), "}")
+
+	for _, param := range splitExceptOnQuotes(raw) {
+		parts := strings.SplitN(param, "=", 2)
+		if len(parts) != 2 {
+			log.Warningf(nil, "image attribute %q has no value, ignoring", param)
+
+			continue
+		}
+
+		value := strings.TrimSuffix(unquote(parts[1]), "px")
+
+		switch parts[0] {
+		case "width":
+			attributes.Width = value
+
+		case "height":
+			attributes.Height = value
+
+		default:
+			log.Warningf(nil, "unknown image attribute %q, ignoring", parts[0])
+		}
+	}
+
+	return attributes
+}
+
+// applyImageAttributes moves attribute blocks and size suffixes of images
+// into `width` and `height` query parameters of image destination, which
+// are then rendered as ac:image parameters.
+func applyImageAttributes(markdown []byte) []byte {
+	markdown = replaceOutsideCode(
+		markdown,
+		reImageSizeSuffix,
+		func(match []byte) []byte {
+			groups := reImageSizeSuffix.FindSubmatch(match)
+
+			attributes := ImageAttributes{
+				Width:  string(groups[3]),
+				Height: string(groups[4]),
+			}
+
+			if attributes.Width == "" && attributes.Height == "" {
+				return match
+			}
+
+			result := append([]byte{}, groups[1]...)
+			result = append(
+				result,
+				withImageSize(string(groups[2]), attributes)...,
+			)
+			result = append(result, groups[5]...)
+
+			return append(result, ')')
+		},
+	)
+
+	return replaceOutsideCode(
+		markdown,
+		reImageAttributes,
+		func(match []byte) []byte {
+			groups := reImageAttributes.FindSubmatch(match)
+
+			attributes := ParseImageAttributes(string(groups[4]))
+
+			result := append([]byte{}, groups[1]...)
+			result = append(
+				result,
+				withImageSize(string(groups[2]), attributes)...,
+			)
+			result = append(result, groups[3]...)
+
+			return append(result, ')')
+		},
+	)
+}
+
+// withImageSize appends given sizes to image destination as query
+// parameters.
+func withImageSize(dest string, attributes ImageAttributes) string {
+	query := url.Values{}
+	if attributes.Width != "" {
+		query.Set("width", attributes.Width)
+	}
+
+	if attributes.Height != "" {
+		query.Set("height", attributes.Height)
+	}
+
+	if len(query) == 0 {
+		return dest
+	}
+
+	separator := "?"
+	if strings.Contains(dest, "?") {
+		separator = "&"
+	}
+
+	return dest + separator + query.Encode()
+}
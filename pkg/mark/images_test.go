@@ -0,0 +1,23 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseImageAttributes(t *testing.T) {
+	assert.Equal(
+		t,
+		ImageAttributes{Width: "300", Height: "200"},
+		ParseImageAttributes(`{width=300 height="200px"}`),
+	)
+
+	assert.Equal(
+		t,
+		ImageAttributes{Width: "120"},
+		ParseImageAttributes(`{width=120 align=center}`),
+	)
+
+	assert.Equal(t, ImageAttributes{}, ParseImageAttributes(`{}`))
+}
@@ -0,0 +1,169 @@
+package mark
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/reconquest/pkg/log"
+)
+
+// InfoStringError describes malformed parameter of fenced code block info
+// string.
+type InfoStringError struct {
+	Field   string
+	Raw     string
+	Message string
+}
+
+func (err InfoStringError) Error() string {
+	return fmt.Sprintf("%s: %s (%q)", err.Field, err.Message, err.Raw)
+}
+
+// ValidateInfoString checks parameters of fenced code block info string
+// and returns all problems found, so they can be reported to the author
+// before the page is uploaded.
+func ValidateInfoString(info string) []InfoStringError {
+	errs := []InfoStringError{}
+
+	params := splitExceptOnQuotes(info)
+	for i, param := range params {
+		field := param
+		if index := strings.Index(param, "="); index >= 0 {
+			field = param[:index]
+		}
+
+		if !hasBalancedQuotes(param) {
+			errs = append(errs, InfoStringError{
+				Field:   field,
+				Raw:     param,
+				Message: "quoted value is not terminated",
+			})
+
+			continue
+		}
+
+		switch {
+		case param == "theme":
+			errs = append(errs, InfoStringError{
+				Field:   field,
+				Raw:     param,
+				Message: "theme should be given as theme=<name>",
+			})
+
+		case param == "title" && i == len(params)-1:
+			errs = append(errs, InfoStringError{
+				Field:   field,
+				Raw:     param,
+				Message: "title is not specified",
+			})
+
+		case field != param && unquote(param[len(field)+1:]) == "":
+			errs = append(errs, InfoStringError{
+				Field:   field,
+				Raw:     param,
+				Message: "value is not specified",
+			})
+
+		case field != param &&
+			field != "title" &&
+			field != "theme" &&
+			field != "language":
+			errs = append(errs, InfoStringError{
+				Field:   field,
+				Raw:     param,
+				Message: "unknown parameter",
+			})
+		}
+	}
+
+	return errs
+}
+
+// hasBalancedQuotes reports whether every double quote in the param, which
+// is not escaped as \", has a closing one.
+func hasBalancedQuotes(param string) bool {
+	var (
+		quoted  bool
+		escaped bool
+	)
+
+	for _, char := range param {
+		switch {
+		case escaped:
+			escaped = false
+
+		case char == '\\' && quoted:
+			escaped = true
+
+		case char == '"':
+			quoted = !quoted
+		}
+	}
+
+	return !quoted
+}
+
+// reInfoAttributes matches Pandoc-style attributes of the code block given
+// in the info string like `{.python .numberLines}` or `python {.numberLines}`,
+// capturing language given before the braces and attributes.
+var reInfoAttributes = regexp.MustCompile(`^\s*([^\s{}]*)\s*\{([^{}]*)\}\s*$`)
+
+// reInfoAttribute matches single attribute: .class, #id or key=value.
+var reInfoAttribute = regexp.MustCompile(
+	`^(?:\.([^\s.#="]+)|#(\S+)|[\w-]+=\S*)$`,
+)
+
+// expandInfoAttributes rewrites Pandoc-style attributes of the code block
+// into usual info string parameters: the first class is the language,
+// .numberLines and .collapse are flags, key=value attributes are kept as is
+// and ids are dropped, since code blocks have no anchors. Parser strips
+// braces of the info string given as {...}, so attributes are recognized
+// without braces too if the info string starts with . or #. Info strings
+// which don't consist of attributes are returned as is.
+func expandInfoAttributes(info string) string {
+	var language, attributes string
+
+	if groups := reInfoAttributes.FindStringSubmatch(info); groups != nil {
+		language, attributes = groups[1], groups[2]
+	} else {
+		attributes = strings.TrimSpace(info)
+		if !strings.HasPrefix(attributes, ".") &&
+			!strings.HasPrefix(attributes, "#") {
+			return info
+		}
+	}
+
+	var params []string
+
+	for _, attribute := range splitExceptOnQuotes(attributes) {
+		parts := reInfoAttribute.FindStringSubmatch(attribute)
+		if parts == nil {
+			return info
+		}
+
+		switch {
+		case parts[1] == "numberLines" || parts[1] == "number-lines":
+			params = append(params, "linenumbers")
+
+		case parts[1] == "collapse":
+			params = append(params, "collapse")
+
+		case parts[1] != "" && language == "":
+			language = parts[1]
+
+		case parts[1] != "":
+			log.Debugf(nil, "code block class %q is ignored", parts[1])
+
+		case parts[2] == "":
+			params = append(params, attribute)
+		}
+	}
+
+	// language goes first, as it's expected by parseInfoString
+	if language != "" {
+		params = append([]string{language}, params...)
+	}
+
+	return strings.Join(params, " ")
+}
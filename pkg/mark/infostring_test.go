@@ -0,0 +1,40 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateInfoString(t *testing.T) {
+	test := assert.New(t)
+
+	test.Empty(ValidateInfoString(`go collapse title="A \"b\" c" theme=Midnight`))
+	test.Empty(ValidateInfoString(`sh title A b c`))
+	test.Empty(ValidateInfoString(`language=go collapse`))
+
+	test.Equal(
+		[]InfoStringError{
+			{
+				Field:   "theme",
+				Raw:     "theme",
+				Message: "theme should be given as theme=<name>",
+			},
+			{
+				Field:   "title",
+				Raw:     `title="unterminated`,
+				Message: "quoted value is not terminated",
+			},
+		},
+		ValidateInfoString(`go theme title="unterminated`),
+	)
+
+	test.Equal(
+		[]InfoStringError{
+			{Field: "theme", Raw: "theme=", Message: "value is not specified"},
+			{Field: "colour", Raw: "colour=red", Message: "unknown parameter"},
+			{Field: "title", Raw: "title", Message: "title is not specified"},
+		},
+		ValidateInfoString(`go theme= colour=red title`),
+	)
+}
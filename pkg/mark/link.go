@@ -1,13 +1,18 @@
 package mark
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"net"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/kovetskiy/mark/pkg/confluence"
 	"github.com/reconquest/karma-go"
@@ -17,98 +22,467 @@ import (
 type LinkSubstitution struct {
 	From string
 	To   string
+
+	// Space and Title identify Confluence page the link points to; they're
+	// empty for anchor-only links.
+	Space string
+	Title string
+}
+
+// PageFinder looks up Confluence pages by space and title or by id.
+// *confluence.API satisfies it; tests may substitute their own.
+type PageFinder interface {
+	FindPage(
+		space string,
+		title string,
+		pageType string,
+	) (*confluence.PageInfo, error)
+
+	GetPageByID(pageID string) (*confluence.PageInfo, error)
+}
+
+const (
+	// DefaultLinkWorkers is the number of links resolved concurrently unless
+	// overridden by WithLinkWorkers.
+	DefaultLinkWorkers = 4
+
+	// DefaultLinkRetries is the number of times page lookup is retried on
+	// transient errors unless overridden by WithLinkRetries.
+	DefaultLinkRetries = 3
+
+	// DefaultLinkRetryDelay is the delay before the first retry, which is
+	// doubled on every next one.
+	DefaultLinkRetryDelay = 100 * time.Millisecond
+)
+
+// LinkResolver resolves relative markdown links into Confluence page links.
+type LinkResolver struct {
+	Finder  PageFinder
+	BaseURL string
+	Edition confluence.ConfluenceEdition
+
+	workers    int
+	retries    int
+	retryDelay time.Duration
+	timeout    time.Duration
+
+	titlePrefix string
+}
+
+type LinkResolverOption func(*LinkResolver)
+
+// WithLinkWorkers sets how many links are resolved concurrently.
+func WithLinkWorkers(workers int) LinkResolverOption {
+	return func(resolver *LinkResolver) {
+		resolver.workers = workers
+	}
+}
+
+// WithLinkRetries sets how many times page lookup is retried on network
+// errors and 5xx responses, waiting delay before the first retry and twice
+// as long before every next one.
+func WithLinkRetries(retries int, delay time.Duration) LinkResolverOption {
+	return func(resolver *LinkResolver) {
+		resolver.retries = retries
+		resolver.retryDelay = delay
+	}
+}
+
+// WithLinkTimeout limits how long single page lookup can take, so links
+// are not resolved forever on slow Confluence instances; lookup which times
+// out fails without retries. Zero timeout means no limit. The timeout is set
+// on HTTP client of the API given to NewLinkResolver.
+func WithLinkTimeout(timeout time.Duration) LinkResolverOption {
+	return func(resolver *LinkResolver) {
+		resolver.timeout = timeout
+	}
+}
+
+// WithPageTitlePrefix sets prefix like `[MYPRODUCT] ` which titles of pages
+// in Confluence have, but titles given in meta of linked documents don't.
+func WithPageTitlePrefix(prefix string) LinkResolverOption {
+	return func(resolver *LinkResolver) {
+		resolver.titlePrefix = prefix
+	}
+}
+
+func NewLinkResolver(
+	api *confluence.API,
+	options ...LinkResolverOption,
+) *LinkResolver {
+	resolver := &LinkResolver{
+		Finder:  api,
+		BaseURL: api.BaseURL,
+		Edition: api.Edition,
+		workers: DefaultLinkWorkers,
+
+		retries:    DefaultLinkRetries,
+		retryDelay: DefaultLinkRetryDelay,
+	}
+
+	for _, option := range options {
+		option(resolver)
+	}
+
+	if resolver.timeout > 0 {
+		resolver.Finder = api.WithTimeout(resolver.timeout)
+	}
+
+	return resolver
 }
 
 type markdownLink struct {
+	text     string
 	full     string
 	filename string
+	query    string
 	hash     string
+	line     int
+
+	// autolink is given as <https://...> rather than [text](link)
+	autolink bool
+}
+
+// UnresolvedLink is a link to markdown file which can't be resolved into
+// Confluence page; Line is 1-based line of the link in the document.
+type UnresolvedLink struct {
+	Link string
+	Line int
 }
 
+// ResolveRelativeLinks resolves relative links to markdown files into links
+// to Confluence pages; cancelling the context stops resolving links which
+// are not resolved yet.
 func ResolveRelativeLinks(
-	api *confluence.API,
+	ctx context.Context,
+	resolver *LinkResolver,
 	meta *Meta,
 	markdown []byte,
 	base string,
 ) ([]LinkSubstitution, error) {
+	links, _, err := PreviewRelativeLinks(ctx, resolver, meta, markdown, base)
+	if err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// PreviewRelativeLinks works like ResolveRelativeLinks, but also returns
+// links to markdown files which can't be resolved into Confluence pages,
+// so links can be validated before the page is published.
+func PreviewRelativeLinks(
+	ctx context.Context,
+	resolver *LinkResolver,
+	meta *Meta,
+	markdown []byte,
+	base string,
+) ([]LinkSubstitution, []UnresolvedLink, error) {
 	matches := parseLinks(string(markdown))
 
-	links := []LinkSubstitution{}
-	for _, match := range matches {
-		log.Tracef(
-			nil,
-			"found a relative link: full=%s filename=%s hash=%s",
-			match.full,
-			match.filename,
-			match.hash,
-		)
+	type result struct {
+		resolved string
+		meta     *Meta
+		err      error
+	}
 
-		resolved, err := resolveLink(api, base, match)
-		if err != nil {
-			return nil, karma.Format(err, "resolve link: %q", match.full)
+	results := make([]result, len(matches))
+
+	workers := resolver.workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	queue := make(chan int)
+	group := sync.WaitGroup{}
+
+	for i := 0; i < workers; i++ {
+		group.Add(1)
+
+		go func() {
+			defer group.Done()
+
+			for index := range queue {
+				match := matches[index]
+
+				log.Tracef(
+					nil,
+					"found a relative link at line %d: "+
+						"text=%q full=%s filename=%s query=%s hash=%s",
+					match.line,
+					match.text,
+					match.full,
+					match.filename,
+					match.query,
+					match.hash,
+				)
+
+				// links left in the queue are not resolved once cancelled
+				if err := ctx.Err(); err != nil {
+					results[index] = result{err: err}
+
+					continue
+				}
+
+				resolved, meta, err := resolveLink(ctx, resolver, base, match)
+
+				results[index] = result{
+					resolved: resolved,
+					meta:     meta,
+					err:      err,
+				}
+			}
+		}()
+	}
+
+	for index := range matches {
+		queue <- index
+	}
+
+	close(queue)
+
+	group.Wait()
+
+	links := []LinkSubstitution{}
+	unresolved := []UnresolvedLink{}
+	for index, match := range matches {
+		if results[index].err != nil {
+			return nil, nil, karma.Format(
+				results[index].err,
+				"resolve link at line %d: %q",
+				match.line,
+				match.full,
+			)
 		}
 
-		if resolved == "" {
+		if results[index].resolved == "" {
+			if isMarkdownLink(match) {
+				unresolved = append(unresolved, UnresolvedLink{
+					Link: match.full,
+					Line: match.line,
+				})
+			}
+
 			continue
 		}
 
-		links = append(links, LinkSubstitution{
+		link := LinkSubstitution{
 			From: match.full,
-			To:   resolved,
-		})
+			To:   results[index].resolved,
+		}
+
+		if results[index].meta != nil {
+			link.Space = results[index].meta.Space
+			link.Title = results[index].meta.Title
+		}
+
+		links = append(links, link)
 	}
 
-	return links, nil
+	return links, unresolved, nil
+}
+
+// isMarkdownLink reports whether link points to local markdown file rather
+// than to attachment or external resource.
+func isMarkdownLink(link markdownLink) bool {
+	uri, err := url.Parse(link.filename)
+	if err != nil || uri.Scheme != "" || uri.Host != "" {
+		return false
+	}
+
+	extension := filepath.Ext(uri.Path)
+
+	return strings.EqualFold(extension, ".md") ||
+		strings.EqualFold(extension, ".markdown")
 }
 
 func resolveLink(
-	api *confluence.API,
+	ctx context.Context,
+	resolver *LinkResolver,
 	base string,
 	link markdownLink,
-) (string, error) {
+) (string, *Meta, error) {
 	var result string
 
-	if len(link.filename) > 0 {
-		filepath := filepath.Join(base, link.filename)
-		if _, err := os.Stat(filepath); err != nil {
-			return "", nil
-		}
+	// empty links like [text]() point nowhere, so there's nothing to resolve
+	if len(link.filename) == 0 && len(link.hash) == 0 {
+		return "", nil, nil
+	}
 
-		linkContents, err := ioutil.ReadFile(filepath)
-		if err != nil {
-			return "", karma.Format(err, "read file: %s", filepath)
-		}
+	// anchor-only links point to the same page, so they are kept as is and
+	// rendered as Confluence anchor links later
+	if len(link.filename) == 0 {
+		return "#" + link.hash, nil, nil
+	}
+
+	if link.autolink {
+		return resolveAutolink(ctx, resolver, link)
+	}
 
-		// This helps to determine if found link points to file that's
-		// not markdown or have mark required metadata
-		linkMeta, _, err := ExtractMeta(linkContents)
+	// links like mailto:, tel: or https:// point to other resources, which
+	// have nothing to do with local files
+	if hasScheme(link.filename) {
+		return "", nil, nil
+	}
+
+	// base is resolved first, otherwise ../ in the link would be
+	// cleaned lexically against the symlink itself instead of its target
+	base, err := filepath.EvalSymlinks(base)
+	if err != nil {
+		return "", nil, nil
+	}
+
+	// links to files with spaces and other special characters in names are
+	// usually percent-encoded, e.g. path%20with%20spaces.md
+	filename, err := url.PathUnescape(link.filename)
+	if err != nil {
+		filename = link.filename
+	}
+
+	filepath, err := filepath.EvalSymlinks(
+		filepath.Join(base, filename),
+	)
+	if err != nil {
+		return "", nil, nil
+	}
+
+	file, err := os.Open(filepath)
+	if err != nil {
+		return "", nil, karma.Format(err, "read file: %s", filepath)
+	}
+
+	// This helps to determine if found link points to file that's
+	// not markdown or have mark required metadata
+	linkMeta, err := ParseMarkdownMeta(file)
+
+	file.Close()
+
+	if err != nil {
+		log.Errorf(
+			err,
+			"unable to extract metadata from %q; ignoring the relative link",
+			filepath,
+		)
+
+		return "", nil, nil
+	}
+
+	if linkMeta == nil {
+		return "", nil, nil
+	}
+
+	// page id identifies the page even if its title is used in other spaces
+	if linkMeta.PageID != "" {
+		result, err = resolver.getConfluenceLinkByID(
+			ctx,
+			linkMeta.Space,
+			linkMeta.PageID,
+		)
 		if err != nil {
-			log.Errorf(
+			return "", nil, karma.Format(
 				err,
-				"unable to extract metadata from %q; ignoring the relative link",
+				"find confluence page: %s / page id %s",
 				filepath,
+				linkMeta.PageID,
 			)
-
-			return "", nil
-		}
-
-		if linkMeta == nil {
-			return "", nil
 		}
 
-		result, err = getConfluenceLink(api, linkMeta.Space, linkMeta.Title)
-		if err != nil {
-			return "", karma.Format(
-				err,
-				"find confluence page: %s / %s / %s",
+		if result == "" && linkMeta.Title != "" {
+			log.Warningf(
+				nil,
+				"page with id %s given in %q is not found; "+
+					"resolving the link by title",
+				linkMeta.PageID,
 				filepath,
-				linkMeta.Space,
-				linkMeta.Title,
 			)
 		}
+	}
 
-		if result == "" {
-			return "", nil
+	if result == "" && linkMeta.Title != "" {
+		result, err = resolver.getConfluenceLink(
+			ctx,
+			linkMeta.Space,
+			linkMeta.Title,
+		)
+	}
+	if err != nil {
+		return "", nil, karma.Format(
+			err,
+			"find confluence page: %s / %s / %s",
+			filepath,
+			linkMeta.Space,
+			linkMeta.Title,
+		)
+	}
+
+	if result == "" {
+		return "", nil, nil
+	}
+
+	if resolver.titlePrefix != "" {
+		prefixed := *linkMeta
+		prefixed.Title = resolver.titlePrefix + linkMeta.Title
+
+		linkMeta = &prefixed
+	}
+
+	return withQueryAndHash(result, link), linkMeta, nil
+}
+
+// resolveAutolink resolves autolink to Confluence page given by its title,
+// like <https://confluence.example.com/display/SPACE/Page+Title>, into the
+// actual link to the page; other autolinks are not resolved.
+func resolveAutolink(
+	ctx context.Context,
+	resolver *LinkResolver,
+	link markdownLink,
+) (string, *Meta, error) {
+	path := strings.TrimPrefix(link.filename, resolver.BaseURL+"/display/")
+	if path == link.filename {
+		return "", nil, nil
+	}
+
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", nil, nil
+	}
+
+	// Confluence gives spaces of titles in /display/ links as +
+	title, err := url.PathUnescape(strings.ReplaceAll(parts[1], "+", " "))
+	if err != nil {
+		return "", nil, nil
+	}
+
+	space := parts[0]
+
+	page, err := resolver.findPage(ctx, space, title)
+	if err != nil {
+		return "", nil, karma.Format(
+			err,
+			"find confluence page: %s / %s",
+			space,
+			title,
+		)
+	}
+
+	if page == nil {
+		return "", nil, nil
+	}
+
+	result := withQueryAndHash(resolver.pageLink(space, title, page), link)
+
+	return result, &Meta{Space: space, Title: title}, nil
+}
+
+// withQueryAndHash appends query and anchor of the markdown link to the
+// resolved one.
+func withQueryAndHash(result string, link markdownLink) string {
+	// Confluence links might have query of their own, like ?pageId=42
+	if len(link.query) > 0 {
+		if strings.Contains(result, "?") {
+			result = result + "&" + link.query
+		} else {
+			result = result + "?" + link.query
 		}
 	}
 
@@ -116,10 +490,30 @@ func resolveLink(
 		result = result + "#" + link.hash
 	}
 
-	return result, nil
+	return result
 }
 
-func SubstituteLinks(markdown []byte, links []LinkSubstitution) []byte {
+// hasScheme reports whether link starts with URL scheme, i.e. has colon
+// before any slash.
+func hasScheme(link string) bool {
+	colon := strings.Index(link, ":")
+	if colon < 0 {
+		return false
+	}
+
+	slash := strings.Index(link, "/")
+
+	return slash < 0 || colon < slash
+}
+
+// SubstituteLinks replaces resolved links in markdown and returns the number
+// of links which were actually found and replaced.
+func SubstituteLinks(
+	markdown []byte,
+	links []LinkSubstitution,
+) ([]byte, int) {
+	substituted := 0
+
 	for _, link := range links {
 		if link.From == link.To {
 			continue
@@ -127,52 +521,313 @@ func SubstituteLinks(markdown []byte, links []LinkSubstitution) []byte {
 
 		log.Tracef(nil, "substitute link: %q -> %q", link.From, link.To)
 
-		markdown = bytes.ReplaceAll(
+		// filename part of the link is matched case-insensitively because
+		// README.md and readme.md are the same file on macOS and Windows
+		filename, hash := link.From, ""
+		if index := strings.Index(link.From, "#"); index >= 0 {
+			filename, hash = link.From[:index], link.From[index:]
+		}
+
+		from := `(?i:` + regexp.QuoteMeta(filename) + `)` +
+			regexp.QuoteMeta(hash)
+
+		// sources of images given as raw HTML and autolinks are substituted
+		// as well
+		markdownLink := regexp.MustCompile(`\]\(` + from + `\)`)
+		htmlSource := regexp.MustCompile(`src="` + from + `"`)
+		autolink := regexp.MustCompile(`<` + from + `>`)
+
+		if !markdownLink.Match(markdown) &&
+			!htmlSource.Match(markdown) &&
+			!autolink.Match(markdown) {
+			continue
+		}
+
+		markdown = markdownLink.ReplaceAllLiteral(
 			markdown,
-			[]byte(fmt.Sprintf("](%s)", link.From)),
 			[]byte(fmt.Sprintf("](%s)", link.To)),
 		)
+
+		markdown = htmlSource.ReplaceAllLiteral(
+			markdown,
+			[]byte(fmt.Sprintf(`src="%s"`, link.To)),
+		)
+
+		markdown = autolink.ReplaceAllLiteral(
+			markdown,
+			[]byte(fmt.Sprintf(`<%s>`, link.To)),
+		)
+
+		substituted++
 	}
 
-	return markdown
+	return markdown, substituted
+}
+
+// reAutolink matches CommonMark autolink like <https://example.com>,
+// capturing link, link without query and anchor, scheme, query and anchor.
+var reAutolink = regexp.MustCompile(
+	`<((([a-zA-Z][a-zA-Z0-9+.-]{1,31}):[^\s<>?#]*)` +
+		`(?:\?([^\s<>#]*))?(?:#([^\s<>]*))?)>`,
+)
+
+// confluenceNamespaces lists namespaces of Confluence Storage Format tags.
+var confluenceNamespaces = map[string]bool{
+	"ac": true,
+	"ri": true,
+	"at": true,
 }
 
 func parseLinks(markdown string) []markdownLink {
-	re := regexp.MustCompile("\\[[^\\]]+\\]\\((([^\\)#]+)?#?([^\\)]+)?)\\)")
-	matches := re.FindAllStringSubmatch(markdown, -1)
-
-	links := make([]markdownLink, len(matches))
-	for i, match := range matches {
-		links[i] = markdownLink{
-			full:     match[1],
-			filename: match[2],
-			hash:     match[3],
+	// links in code blocks are examples rather than real links; code blocks
+	// are replaced with blank lines to keep line numbers of links after them
+	markdown = reFencedCode.ReplaceAllStringFunc(
+		markdown,
+		func(code string) string {
+			return strings.Repeat("\n", strings.Count(code, "\n"))
+		},
+	)
+
+	// query is not a part of the file name, e.g. page.md?anchor=foo
+	re := regexp.MustCompile(
+		"\\[([^\\]]+)\\]\\((([^\\)#?]+)?(?:\\?([^\\)#]*))?#?([^\\)]+)?)\\)",
+	)
+
+	type found struct {
+		start int
+		link  markdownLink
+	}
+
+	// links are matched over the whole document, since link text might be
+	// wrapped onto the next line
+	line := func(offset int) int {
+		return strings.Count(markdown[:offset], "\n") + 1
+	}
+
+	var matches []found
+
+	for _, match := range re.FindAllStringSubmatchIndex(markdown, -1) {
+		group := func(n int) string {
+			return submatch(markdown, match, n)
+		}
+
+		matches = append(matches, found{
+			start: match[0],
+			link: markdownLink{
+				text:     group(1),
+				full:     group(2),
+				filename: group(3),
+				query:    group(4),
+				hash:     group(5),
+				line:     line(match[0]),
+			},
+		})
+	}
+
+	for _, match := range reAutolink.FindAllStringSubmatchIndex(markdown, -1) {
+		group := func(n int) string {
+			return submatch(markdown, match, n)
 		}
+
+		// tags like <ac:rich-text-body> look like autolinks
+		if confluenceNamespaces[strings.ToLower(group(3))] {
+			continue
+		}
+
+		matches = append(matches, found{
+			start: match[0],
+			link: markdownLink{
+				text:     group(1),
+				full:     group(1),
+				filename: group(2),
+				query:    group(4),
+				hash:     group(5),
+				line:     line(match[0]),
+				autolink: true,
+			},
+		})
+	}
+
+	// links are kept in order of appearance
+	sort.SliceStable(matches, func(a, b int) bool {
+		return matches[a].start < matches[b].start
+	})
+
+	links := []markdownLink{}
+	for _, match := range matches {
+		links = append(links, match.link)
 	}
 
 	return links
 }
 
+// submatch returns n-th group of the match given as indexes, or empty string
+// if the group is not matched.
+func submatch(text string, match []int, n int) string {
+	if match[2*n] < 0 {
+		return ""
+	}
+
+	return text[match[2*n]:match[2*n+1]]
+}
+
 // getConfluenceLink build (to be) link for Conflunce, and tries to verify from
-// API if there's real link available
-func getConfluenceLink(api *confluence.API, space, title string) (string, error) {
+// API if there's real link available. Link to the page which is not created
+// yet is given in /display/ format, which Confluence Cloud redirects too,
+// since Cloud URL needs page id.
+func (resolver *LinkResolver) getConfluenceLink(
+	ctx context.Context,
+	space, title string,
+) (string, error) {
+	title = resolver.titlePrefix + title
+
 	link := fmt.Sprintf(
 		"%s/display/%s/%s",
-		api.BaseURL,
+		resolver.BaseURL,
 		space,
-		url.QueryEscape(title),
+		url.PathEscape(title),
 	)
 
-	page, err := api.FindPage(space, title, "page")
+	page, err := resolver.findPage(ctx, space, title)
 	if err != nil {
 		return "", karma.Format(err, "api: find page")
 	}
 
 	if page != nil {
-		// Needs baseURL, as REST api response URL doesn't contain subpath ir
-		// confluence is server from that
-		link = api.BaseURL + page.Links.Full
+		link = resolver.pageLink(space, title, page)
 	}
 
 	return link, nil
 }
+
+// pageLink returns link to the found page in format of the Confluence
+// edition. Space is given by the caller, since page info doesn't have it;
+// if it's not known, link given by the API is used as is.
+func (resolver *LinkResolver) pageLink(
+	space, title string,
+	page *confluence.PageInfo,
+) string {
+	if resolver.Edition == confluence.Cloud && space != "" {
+		return fmt.Sprintf(
+			"%s/spaces/%s/pages/%s/%s",
+			resolver.BaseURL,
+			space,
+			page.ID,
+			url.PathEscape(title),
+		)
+	}
+
+	// Needs baseURL, as REST api response URL doesn't contain subpath ir
+	// confluence is server from that
+	return resolver.BaseURL + page.Links.Full
+}
+
+// getConfluenceLinkByID builds link to the page with given id in the given
+// space, which is looked up to get its actual title and URL.
+func (resolver *LinkResolver) getConfluenceLinkByID(
+	ctx context.Context,
+	space, pageID string,
+) (string, error) {
+	page, err := resolver.retry(
+		ctx,
+		"page "+pageID,
+		func() (*confluence.PageInfo, error) {
+			page, err := resolver.Finder.GetPageByID(pageID)
+
+			// page might be deleted or id given in meta might be wrong,
+			// so the link is left unresolved instead of failing
+			var statusErr *confluence.StatusError
+			if errors.As(err, &statusErr) && statusErr.StatusCode == 404 {
+				return nil, nil
+			}
+
+			return page, err
+		},
+	)
+	if err != nil {
+		return "", karma.Format(err, "api: get page by id: %s", pageID)
+	}
+
+	if page == nil {
+		return "", nil
+	}
+
+	return resolver.pageLink(space, page.Title, page), nil
+}
+
+// findPage looks up the page retrying on transient errors.
+func (resolver *LinkResolver) findPage(
+	ctx context.Context,
+	space, title string,
+) (*confluence.PageInfo, error) {
+	return resolver.retry(
+		ctx,
+		"page "+space+" / "+title,
+		func() (*confluence.PageInfo, error) {
+			return resolver.Finder.FindPage(space, title, "page")
+		},
+	)
+}
+
+// retry calls lookup until it succeeds, fails with non-transient error,
+// retries are exhausted or context is cancelled.
+func (resolver *LinkResolver) retry(
+	ctx context.Context,
+	what string,
+	lookup func() (*confluence.PageInfo, error),
+) (*confluence.PageInfo, error) {
+	delay := resolver.retryDelay
+
+	for attempt := 0; ; attempt++ {
+		page, err := resolver.lookup(ctx, what, lookup)
+		if err == nil || attempt >= resolver.retries || !isTransient(err) {
+			return page, err
+		}
+
+		log.Warningf(
+			err,
+			"unable to find %s, retrying in %s",
+			what,
+			delay,
+		)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, karma.Format(ctx.Err(), "lookup of %s is cancelled", what)
+		}
+
+		delay *= 2
+	}
+}
+
+// lookup calls lookup function unless context is already cancelled; request
+// in progress is not interrupted, it's limited by the API client timeout.
+func (resolver *LinkResolver) lookup(
+	ctx context.Context,
+	what string,
+	lookup func() (*confluence.PageInfo, error),
+) (*confluence.PageInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, karma.Format(err, "lookup of %s is cancelled", what)
+	}
+
+	return lookup()
+}
+
+// isTransient reports whether error is caused by network failure or server
+// side error, so request might succeed if retried.
+func isTransient(err error) bool {
+	var statusErr *confluence.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Temporary()
+	}
+
+	// timeouts are set to fail fast, so they are not retried
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return !netErr.Timeout()
+	}
+
+	return false
+}
@@ -1,11 +1,103 @@
 package mark
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/kovetskiy/mark/pkg/confluence"
 	"github.com/stretchr/testify/assert"
 )
 
+type fakePageFinder struct {
+	pages map[string]*confluence.PageInfo
+	ids   map[string]*confluence.PageInfo
+	err   error
+}
+
+func (finder *fakePageFinder) GetPageByID(
+	pageID string,
+) (*confluence.PageInfo, error) {
+	if finder.err != nil {
+		return nil, finder.err
+	}
+
+	page, ok := finder.ids[pageID]
+	if !ok {
+		return nil, &confluence.StatusError{
+			StatusCode: 404,
+			Status:     "404 Not Found",
+		}
+	}
+
+	return page, nil
+}
+
+func (finder *fakePageFinder) FindPage(
+	space string,
+	title string,
+	pageType string,
+) (*confluence.PageInfo, error) {
+	if finder.err != nil {
+		return nil, finder.err
+	}
+
+	return finder.pages[space+"/"+title], nil
+}
+
+// flakyPageFinder fails given number of times before finding nothing.
+type flakyPageFinder struct {
+	failures int
+	err      error
+	calls    int
+}
+
+func (finder *flakyPageFinder) FindPage(
+	space string,
+	title string,
+	pageType string,
+) (*confluence.PageInfo, error) {
+	finder.calls++
+
+	if finder.calls <= finder.failures {
+		return nil, finder.err
+	}
+
+	return nil, nil
+}
+
+func (finder *flakyPageFinder) GetPageByID(
+	pageID string,
+) (*confluence.PageInfo, error) {
+	return finder.FindPage("", "", "page")
+}
+
+type slowPageFinder struct {
+	release chan struct{}
+}
+
+func (finder *slowPageFinder) FindPage(
+	space string,
+	title string,
+	pageType string,
+) (*confluence.PageInfo, error) {
+	<-finder.release
+
+	return nil, nil
+}
+
+func (finder *slowPageFinder) GetPageByID(
+	pageID string,
+) (*confluence.PageInfo, error) {
+	return finder.FindPage("", "", "page")
+}
+
 func TestParseLinks(t *testing.T) {
 	markdown := `
 	[example1](../path/to/example.md#second-heading)
@@ -19,6 +111,7 @@ func TestParseLinks(t *testing.T) {
 
 	links := parseLinks(markdown)
 
+	assert.Equal(t, "example1", links[0].text)
 	assert.Equal(t, "../path/to/example.md#second-heading", links[0].full)
 	assert.Equal(t, "../path/to/example.md", links[0].filename)
 	assert.Equal(t, "second-heading", links[0].hash)
@@ -31,6 +124,7 @@ func TestParseLinks(t *testing.T) {
 	assert.Equal(t, "", links[2].filename)
 	assert.Equal(t, "heading-in-document", links[2].hash)
 
+	assert.Equal(t, "Text link that should be put as attachment", links[3].text)
 	assert.Equal(t, "../path/to/example.txt", links[3].full)
 	assert.Equal(t, "../path/to/example.txt", links[3].filename)
 	assert.Equal(t, "", links[3].hash)
@@ -49,3 +143,881 @@ func TestParseLinks(t *testing.T) {
 
 	assert.Equal(t, len(links), 7)
 }
+
+func TestParseLinks_FencedCode(t *testing.T) {
+	markdown := text(
+		"[real](real.md)",
+		"",
+		"```markdown",
+		"[example](example.md)",
+		"```",
+		"",
+		"~~~",
+		"[another example](another.md)",
+		"~~~",
+		"",
+		"[also real](also-real.md#hash)",
+	)
+
+	links := parseLinks(markdown)
+
+	assert.Equal(t, []markdownLink{
+		{text: "real", full: "real.md", filename: "real.md", line: 1},
+		{
+			text:     "also real",
+			full:     "also-real.md#hash",
+			filename: "also-real.md",
+			hash:     "hash",
+			line:     11,
+		},
+	}, links)
+}
+
+func TestParseLinks_WrappedText(t *testing.T) {
+	links := parseLinks(text(
+		"Intro.",
+		"",
+		"See [the installation",
+		"guide](install.md) first.",
+	))
+
+	assert.Equal(t, []markdownLink{
+		{
+			text:     "the installation\nguide",
+			full:     "install.md",
+			filename: "install.md",
+			line:     3,
+		},
+	}, links)
+}
+
+func TestParseLinks_Autolinks(t *testing.T) {
+	links := parseLinks(text(
+		"See <https://example.com/page?a=1#top> and [docs](docs.md).",
+		"<ac:rich-text-body><mailto:team@example.com>",
+	))
+
+	assert.Equal(t, []markdownLink{
+		{
+			text:     "https://example.com/page?a=1#top",
+			full:     "https://example.com/page?a=1#top",
+			filename: "https://example.com/page",
+			query:    "a=1",
+			hash:     "top",
+			line:     1,
+			autolink: true,
+		},
+		{text: "docs", full: "docs.md", filename: "docs.md", line: 1},
+		{
+			text:     "mailto:team@example.com",
+			full:     "mailto:team@example.com",
+			filename: "mailto:team@example.com",
+			line:     2,
+			autolink: true,
+		},
+	}, links)
+}
+
+func TestResolveRelativeLinks_Autolinks(t *testing.T) {
+	page := &confluence.PageInfo{}
+	page.Links.Full = "/pages/viewpage.action?pageId=42"
+
+	resolver := &LinkResolver{
+		Finder: &fakePageFinder{
+			pages: map[string]*confluence.PageInfo{"SPACE/Page Title": page},
+		},
+		BaseURL: "https://confluence.example.com",
+	}
+
+	markdown := []byte(text(
+		"<https://confluence.example.com/display/SPACE/Page+Title#usage>",
+		"<https://confluence.example.com/display/SPACE/Missing>",
+		"<https://example.com/display/SPACE/Page+Title>",
+	))
+
+	links, err := ResolveRelativeLinks(
+		context.Background(),
+		resolver,
+		nil,
+		markdown,
+		".",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []LinkSubstitution{
+		{
+			From: "https://confluence.example.com/display/SPACE/Page+Title#usage",
+			To: "https://confluence.example.com" +
+				"/pages/viewpage.action?pageId=42#usage",
+			Space: "SPACE",
+			Title: "Page Title",
+		},
+	}, links)
+
+	markdown, substituted := SubstituteLinks(markdown, links)
+	assert.Equal(t, 1, substituted)
+	assert.Equal(
+		t,
+		text(
+			"<https://confluence.example.com/pages/viewpage.action?pageId=42#usage>",
+			"<https://confluence.example.com/display/SPACE/Missing>",
+			"<https://example.com/display/SPACE/Page+Title>",
+		),
+		string(markdown),
+	)
+}
+
+func TestGetConfluenceLink(t *testing.T) {
+	page := &confluence.PageInfo{}
+	page.Links.Full = "/pages/viewpage.action?pageId=42"
+
+	resolver := &LinkResolver{
+		Finder: &fakePageFinder{
+			pages: map[string]*confluence.PageInfo{"SPACE/Found": page},
+		},
+		BaseURL: "https://confluence.example.com",
+	}
+
+	link, err := resolver.getConfluenceLink(context.Background(), "SPACE", "Found")
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"https://confluence.example.com/pages/viewpage.action?pageId=42",
+		link,
+	)
+
+	link, err = resolver.getConfluenceLink(context.Background(), "SPACE", "Missing")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://confluence.example.com/display/SPACE/Missing", link)
+
+	link, err = resolver.getConfluenceLink(
+		context.Background(),
+		"SPACE",
+		"Über Docs / FAQ",
+	)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"https://confluence.example.com/display/SPACE/%C3%9Cber%20Docs%20%2F%20FAQ",
+		link,
+	)
+
+	resolver.Finder = &fakePageFinder{err: errors.New("unavailable")}
+
+	_, err = resolver.getConfluenceLink(context.Background(), "SPACE", "Found")
+	assert.Error(t, err)
+}
+
+func TestGetConfluenceLink_TitlePrefix(t *testing.T) {
+	page := &confluence.PageInfo{}
+	page.Links.Full = "/pages/viewpage.action?pageId=42"
+
+	resolver := &LinkResolver{
+		Finder: &fakePageFinder{
+			pages: map[string]*confluence.PageInfo{"SPACE/[APP] Found": page},
+		},
+		BaseURL: "https://confluence.example.com",
+	}
+
+	WithPageTitlePrefix("[APP] ")(resolver)
+
+	link, err := resolver.getConfluenceLink(
+		context.Background(),
+		"SPACE",
+		"Found",
+	)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"https://confluence.example.com/pages/viewpage.action?pageId=42",
+		link,
+	)
+
+	link, err = resolver.getConfluenceLink(
+		context.Background(),
+		"SPACE",
+		"Missing",
+	)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"https://confluence.example.com/display/SPACE/%5BAPP%5D%20Missing",
+		link,
+	)
+}
+
+func TestResolveRelativeLinks_TitlePrefix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mark")
+	if err != nil {
+		panic(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(
+		filepath.Join(dir, "found.md"),
+		[]byte("<!-- Space: SPACE -->\n<!-- Title: Found -->\n"),
+		0644,
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	page := &confluence.PageInfo{}
+	page.Links.Full = "/pages/viewpage.action?pageId=42"
+
+	resolver := &LinkResolver{
+		Finder: &fakePageFinder{
+			pages: map[string]*confluence.PageInfo{"SPACE/[APP] Found": page},
+		},
+		BaseURL: "https://confluence.example.com",
+	}
+
+	WithPageTitlePrefix("[APP] ")(resolver)
+
+	links, err := ResolveRelativeLinks(
+		context.Background(),
+		resolver,
+		nil,
+		[]byte("[found](found.md)"),
+		dir,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []LinkSubstitution{
+		{
+			From:  "found.md",
+			To:    "https://confluence.example.com/pages/viewpage.action?pageId=42",
+			Space: "SPACE",
+			Title: "[APP] Found",
+		},
+	}, links)
+}
+
+func TestGetConfluenceLink_Timeout(t *testing.T) {
+	// HTTP client gives up requests taking longer than timeout this way
+	finder := &flakyPageFinder{
+		failures: 1,
+		err: &url.Error{
+			Op:  "Get",
+			URL: "https://confluence.example.com/rest/api/content",
+			Err: context.DeadlineExceeded,
+		},
+	}
+
+	resolver := &LinkResolver{
+		Finder:  finder,
+		BaseURL: "https://confluence.example.com",
+	}
+
+	WithLinkRetries(3, time.Millisecond)(resolver)
+
+	_, err := resolver.getConfluenceLink(context.Background(), "SPACE", "Page")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), context.DeadlineExceeded.Error())
+	assert.Equal(t, 1, finder.calls)
+}
+
+func TestResolveRelativeLinks_Cancelled(t *testing.T) {
+	finder := &slowPageFinder{release: make(chan struct{})}
+
+	defer close(finder.release)
+
+	resolver := &LinkResolver{
+		Finder:  finder,
+		BaseURL: "https://confluence.example.com",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := ResolveRelativeLinks(
+		ctx,
+		resolver,
+		nil,
+		[]byte("[page](page.md)"),
+		".",
+	)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), context.Canceled.Error())
+}
+
+func TestGetConfluenceLink_Cloud(t *testing.T) {
+	page := &confluence.PageInfo{ID: "42"}
+	page.Links.Full = "/pages/viewpage.action?pageId=42"
+
+	resolver := &LinkResolver{
+		Finder: &fakePageFinder{
+			pages: map[string]*confluence.PageInfo{"SPACE/Found Page": page},
+		},
+		BaseURL: "https://example.atlassian.net/wiki",
+		Edition: confluence.Cloud,
+	}
+
+	link, err := resolver.getConfluenceLink(context.Background(), "SPACE", "Found Page")
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"https://example.atlassian.net/wiki/spaces/SPACE/pages/42/Found%20Page",
+		link,
+	)
+
+	link, err = resolver.getConfluenceLink(context.Background(), "SPACE", "Missing")
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"https://example.atlassian.net/wiki/display/SPACE/Missing",
+		link,
+	)
+}
+
+func TestGetConfluenceLinkByID_Cloud(t *testing.T) {
+	page := &confluence.PageInfo{ID: "42", Title: "Found Page"}
+	page.Links.Full = "/spaces/SPACE/pages/42/Found+Page"
+
+	resolver := &LinkResolver{
+		Finder: &fakePageFinder{
+			ids: map[string]*confluence.PageInfo{"42": page},
+		},
+		BaseURL: "https://example.atlassian.net/wiki",
+		Edition: confluence.Cloud,
+	}
+
+	// page id links take the same shape as links found by title
+	link, err := resolver.getConfluenceLinkByID(
+		context.Background(),
+		"SPACE",
+		"42",
+	)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"https://example.atlassian.net/wiki/spaces/SPACE/pages/42/Found%20Page",
+		link,
+	)
+
+	link, err = resolver.getConfluenceLinkByID(context.Background(), "", "42")
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"https://example.atlassian.net/wiki/spaces/SPACE/pages/42/Found+Page",
+		link,
+	)
+}
+
+func TestGetConfluenceLink_Retries(t *testing.T) {
+	finder := &flakyPageFinder{
+		failures: 2,
+		err:      &confluence.StatusError{StatusCode: 503},
+	}
+
+	resolver := &LinkResolver{
+		Finder:  finder,
+		BaseURL: "https://confluence.example.com",
+	}
+
+	WithLinkRetries(3, time.Millisecond)(resolver)
+
+	link, err := resolver.getConfluenceLink(context.Background(), "SPACE", "Page")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://confluence.example.com/display/SPACE/Page", link)
+	assert.Equal(t, 3, finder.calls)
+
+	finder = &flakyPageFinder{
+		failures: 5,
+		err:      &confluence.StatusError{StatusCode: 503},
+	}
+	resolver.Finder = finder
+
+	_, err = resolver.getConfluenceLink(context.Background(), "SPACE", "Page")
+	assert.Error(t, err)
+	assert.Equal(t, 4, finder.calls)
+
+	finder = &flakyPageFinder{
+		failures: 1,
+		err:      &confluence.StatusError{StatusCode: 401},
+	}
+	resolver.Finder = finder
+
+	_, err = resolver.getConfluenceLink(context.Background(), "SPACE", "Page")
+	assert.Error(t, err)
+	assert.Equal(t, 1, finder.calls)
+}
+
+func TestResolveRelativeLinks_Scheme(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mark")
+	if err != nil {
+		panic(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	// file named like the link would be found if the link was taken for
+	// a path
+	err = ioutil.WriteFile(
+		filepath.Join(dir, "mailto:user@example.com"),
+		[]byte("<!-- Space: SPACE -->\n<!-- Title: Mail -->\n"),
+		0644,
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	resolver := &LinkResolver{
+		Finder:  &fakePageFinder{},
+		BaseURL: "https://confluence.example.com",
+	}
+
+	links, err := ResolveRelativeLinks(
+		context.Background(),
+		resolver,
+		nil,
+		[]byte(text(
+			"[Email me](mailto:user@example.com)",
+			"[Call me](tel:+123456789)",
+		)),
+		dir,
+	)
+	assert.NoError(t, err)
+	assert.Empty(t, links)
+
+	assert.True(t, hasScheme("slack://channel?id=1"))
+	assert.False(t, hasScheme("docs/page:1.md"))
+	assert.False(t, hasScheme("page.md"))
+}
+
+func TestSubstituteLinks(t *testing.T) {
+	markdown := []byte(`
+	[exact](docs/readme.md#Usage)
+	[upper](docs/README.md#Usage)
+	[other hash](docs/README.md#usage)
+	<img src="images/Diagram.png" alt="diagram"/>
+	<https://wiki.example.com/x/abc>
+	`)
+
+	markdown, substituted := SubstituteLinks(markdown, []LinkSubstitution{
+		{From: "docs/readme.md#Usage", To: "https://example.com/Readme#Usage"},
+		{From: "docs/missing.md", To: "https://example.com/Missing"},
+		{From: "images/diagram.png", To: "https://example.com/diagram.png"},
+		{
+			From: "https://wiki.example.com/x/abc",
+			To:   "https://wiki.example.com/display/SPACE/Page",
+		},
+	})
+
+	assert.Equal(t, 3, substituted)
+
+	assert.Equal(t, `
+	[exact](https://example.com/Readme#Usage)
+	[upper](https://example.com/Readme#Usage)
+	[other hash](docs/README.md#usage)
+	<img src="https://example.com/diagram.png" alt="diagram"/>
+	<https://wiki.example.com/display/SPACE/Page>
+	`, string(markdown))
+}
+
+func TestResolveRelativeLinks_Symlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mark")
+	if err != nil {
+		panic(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	for _, path := range []string{"repo/docs", "elsewhere/docs"} {
+		err = os.MkdirAll(filepath.Join(dir, path), 0755)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	err = ioutil.WriteFile(
+		filepath.Join(dir, "elsewhere", "target.md"),
+		[]byte("<!-- Space: SPACE -->\n<!-- Title: Target -->\n"),
+		0644,
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	// repo/linked -> elsewhere/docs, so ../target.md from the linked
+	// directory points to elsewhere/target.md
+	err = os.Symlink(
+		filepath.Join(dir, "elsewhere", "docs"),
+		filepath.Join(dir, "repo", "linked"),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	resolver := &LinkResolver{
+		Finder:  &fakePageFinder{},
+		BaseURL: "https://confluence.example.com",
+	}
+
+	links, err := ResolveRelativeLinks(
+		context.Background(),
+		resolver,
+		nil,
+		[]byte("[target](../target.md)"),
+		filepath.Join(dir, "repo", "linked"),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []LinkSubstitution{
+		{
+			From:  "../target.md",
+			To:    "https://confluence.example.com/display/SPACE/Target",
+			Space: "SPACE",
+			Title: "Target",
+		},
+	}, links)
+}
+
+func TestResolveRelativeLinks_Concurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mark")
+	if err != nil {
+		panic(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	markdown := ""
+	expected := []LinkSubstitution{}
+
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("page%d.md", i)
+		title := fmt.Sprintf("Page %d", i)
+
+		err = ioutil.WriteFile(
+			filepath.Join(dir, name),
+			[]byte("<!-- Space: SPACE -->\n<!-- Title: "+title+" -->\n"),
+			0644,
+		)
+		if err != nil {
+			panic(err)
+		}
+
+		markdown += fmt.Sprintf("[%s](%s)\n", title, name)
+
+		expected = append(expected, LinkSubstitution{
+			From: name,
+			To: "https://confluence.example.com/display/SPACE/" +
+				url.PathEscape(title),
+			Space: "SPACE",
+			Title: title,
+		})
+	}
+
+	resolver := &LinkResolver{
+		Finder:  &fakePageFinder{},
+		BaseURL: "https://confluence.example.com",
+	}
+
+	WithLinkWorkers(8)(resolver)
+
+	links, err := ResolveRelativeLinks(
+		context.Background(),
+		resolver,
+		nil,
+		[]byte(markdown),
+		dir,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, links)
+}
+
+func TestResolveRelativeLinks_EncodedFilename(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mark")
+	if err != nil {
+		panic(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(
+		filepath.Join(dir, "path with spaces.md"),
+		[]byte("<!-- Space: SPACE -->\n<!-- Title: Spaces -->\n"),
+		0644,
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	resolver := &LinkResolver{
+		Finder:  &fakePageFinder{},
+		BaseURL: "https://confluence.example.com",
+	}
+
+	links, err := ResolveRelativeLinks(
+		context.Background(),
+		resolver,
+		nil,
+		[]byte("[spaces](path%20with%20spaces.md#hash)"),
+		dir,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []LinkSubstitution{
+		{
+			From:  "path%20with%20spaces.md#hash",
+			To:    "https://confluence.example.com/display/SPACE/Spaces#hash",
+			Space: "SPACE",
+			Title: "Spaces",
+		},
+	}, links)
+}
+
+func TestResolveRelativeLinks_Query(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mark")
+	if err != nil {
+		panic(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	for name, title := range map[string]string{
+		"found.md":   "Found",
+		"missing.md": "Missing",
+	} {
+		err = ioutil.WriteFile(
+			filepath.Join(dir, name),
+			[]byte("<!-- Space: SPACE -->\n<!-- Title: "+title+" -->\n"),
+			0644,
+		)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	page := &confluence.PageInfo{}
+	page.Links.Full = "/pages/viewpage.action?pageId=42"
+
+	resolver := &LinkResolver{
+		Finder: &fakePageFinder{
+			pages: map[string]*confluence.PageInfo{"SPACE/Found": page},
+		},
+		BaseURL: "https://confluence.example.com",
+	}
+
+	links, err := ResolveRelativeLinks(
+		context.Background(),
+		resolver,
+		nil,
+		[]byte(text(
+			"[found](found.md?anchor=foo#hash)",
+			"[missing](missing.md?anchor=foo)",
+		)),
+		dir,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []LinkSubstitution{
+		{
+			From: "found.md?anchor=foo#hash",
+			To: "https://confluence.example.com" +
+				"/pages/viewpage.action?pageId=42&anchor=foo#hash",
+			Space: "SPACE",
+			Title: "Found",
+		},
+		{
+			From:  "missing.md?anchor=foo",
+			To:    "https://confluence.example.com/display/SPACE/Missing?anchor=foo",
+			Space: "SPACE",
+			Title: "Missing",
+		},
+	}, links)
+}
+
+func TestResolveRelativeLinks_AnchorOnly(t *testing.T) {
+	resolver := &LinkResolver{
+		Finder:  &fakePageFinder{},
+		BaseURL: "https://confluence.example.com",
+	}
+
+	links, err := ResolveRelativeLinks(
+		context.Background(),
+		resolver,
+		nil,
+		[]byte(text(
+			"[heading](#heading-in-document)",
+			"[empty]()",
+		)),
+		".",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []LinkSubstitution{
+		{From: "#heading-in-document", To: "#heading-in-document"},
+	}, links)
+
+	markdown, substituted := SubstituteLinks(
+		[]byte("[heading](#heading-in-document)"),
+		links,
+	)
+	assert.Equal(t, "[heading](#heading-in-document)", string(markdown))
+	assert.Equal(t, 0, substituted)
+}
+
+func TestPreviewRelativeLinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mark")
+	if err != nil {
+		panic(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(
+		filepath.Join(dir, "found.md"),
+		[]byte("<!-- Space: SPACE -->\n<!-- Title: Found -->\n"),
+		0644,
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	err = ioutil.WriteFile(
+		filepath.Join(dir, "no-meta.md"),
+		[]byte("# No meta\n"),
+		0644,
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	resolver := &LinkResolver{
+		Finder:  &fakePageFinder{},
+		BaseURL: "https://confluence.example.com",
+	}
+
+	links, unresolved, err := PreviewRelativeLinks(
+		context.Background(),
+		resolver,
+		nil,
+		[]byte(text(
+			"[found](found.md)",
+			"[no meta](no-meta.md)",
+			"[missing](missing.md#hash)",
+			"[image](image.png)",
+			"[external](https://example.com/page.md)",
+		)),
+		dir,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []LinkSubstitution{
+		{
+			From:  "found.md",
+			To:    "https://confluence.example.com/display/SPACE/Found",
+			Space: "SPACE",
+			Title: "Found",
+		},
+	}, links)
+	assert.Equal(t, []UnresolvedLink{
+		{Link: "no-meta.md", Line: 2},
+		{Link: "missing.md#hash", Line: 3},
+	}, unresolved)
+}
+
+func TestResolveRelativeLinks_PageID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mark")
+	if err != nil {
+		panic(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(
+		filepath.Join(dir, "page.md"),
+		[]byte(text(
+			"<!-- Space: SPACE -->",
+			"<!-- Title: Duplicate -->",
+			"<!-- Page-ID: 42 -->",
+			"",
+		)),
+		0644,
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	page := &confluence.PageInfo{}
+	page.Links.Full = "/pages/viewpage.action?pageId=42"
+
+	resolver := &LinkResolver{
+		Finder: &fakePageFinder{
+			ids: map[string]*confluence.PageInfo{"42": page},
+		},
+		BaseURL: "https://confluence.example.com",
+	}
+
+	links, err := ResolveRelativeLinks(
+		context.Background(),
+		resolver,
+		nil,
+		[]byte("[page](page.md)"),
+		dir,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []LinkSubstitution{
+		{
+			From:  "page.md",
+			To:    "https://confluence.example.com/pages/viewpage.action?pageId=42",
+			Space: "SPACE",
+			Title: "Duplicate",
+		},
+	}, links)
+}
+
+func TestResolveRelativeLinks_PageIDNotFound(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mark")
+	if err != nil {
+		panic(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(
+		filepath.Join(dir, "titled.md"),
+		[]byte(text(
+			"<!-- Space: SPACE -->",
+			"<!-- Title: Moved -->",
+			"<!-- Page-ID: 13 -->",
+			"",
+		)),
+		0644,
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	err = ioutil.WriteFile(
+		filepath.Join(dir, "untitled.md"),
+		[]byte("<!-- Page-ID: 13 -->\n"),
+		0644,
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	resolver := &LinkResolver{
+		Finder:  &fakePageFinder{},
+		BaseURL: "https://confluence.example.com",
+	}
+
+	links, unresolved, err := PreviewRelativeLinks(
+		context.Background(),
+		resolver,
+		nil,
+		[]byte(text(
+			"[titled](titled.md)",
+			"[untitled](untitled.md)",
+		)),
+		dir,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []LinkSubstitution{
+		{
+			From:  "titled.md",
+			To:    "https://confluence.example.com/display/SPACE/Moved",
+			Space: "SPACE",
+			Title: "Moved",
+		},
+	}, links)
+	assert.Equal(t, []UnresolvedLink{
+		{Link: "untitled.md", Line: 2},
+	}, unresolved)
+}
@@ -0,0 +1,165 @@
+package mark
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	LintSeverityError   = `error`
+	LintSeverityWarning = `warning`
+)
+
+const (
+	LintCodeMultipleH1   = `multiple-h1`
+	LintCodeBrokenLink   = `broken-link`
+	LintCodeInfoString   = `info-string`
+	LintCodeLongCodeLine = `long-code-line`
+)
+
+// LintMaxCodeLineLength is the length of code block lines, in characters,
+// above which lines are reported, since Confluence doesn't wrap them.
+const LintMaxCodeLineLength = 120
+
+// LintIssue is a problem found in the document by LintMarkdown; Line and
+// Column are 1-based.
+type LintIssue struct {
+	Line     int
+	Column   int
+	Severity string
+	Code     string
+	Message  string
+}
+
+func (issue LintIssue) String() string {
+	return fmt.Sprintf(
+		"%d:%d: %s: %s (%s)",
+		issue.Line,
+		issue.Column,
+		issue.Severity,
+		issue.Message,
+		issue.Code,
+	)
+}
+
+// reLintLink matches links and images, capturing destination without
+// anchor and query.
+var reLintLink = regexp.MustCompile(`!?\[[^\]]*\]\(([^)#?\s]+)`)
+
+// LintMarkdown checks the document for problems which don't prevent it from
+// being compiled, but are likely to be mistakes: H1 headings besides the
+// first one, relative links to files which don't exist, malformed info
+// strings of code blocks and code lines too long to be shown without
+// scrolling. Relative links are checked against baseDir, which is the
+// directory containing the document.
+func LintMarkdown(markdown []byte, baseDir string) []LintIssue {
+	issues := []LintIssue{}
+
+	var (
+		fence []byte
+		h1    bool
+	)
+
+	for i, line := range bytes.Split(markdown, []byte("\n")) {
+		number := i + 1
+
+		line = bytes.TrimSuffix(line, []byte("\r"))
+
+		if fence != nil {
+			// closing fence has no info string
+			closing := bytes.TrimSpace(line)
+			if bytes.HasPrefix(closing, fence) &&
+				len(bytes.Trim(closing, string(fence[:1]))) == 0 {
+				fence = nil
+
+				continue
+			}
+
+			if utf8.RuneCount(line) > LintMaxCodeLineLength {
+				issues = append(issues, LintIssue{
+					Line:     number,
+					Column:   LintMaxCodeLineLength + 1,
+					Severity: LintSeverityWarning,
+					Code:     LintCodeLongCodeLine,
+					Message: fmt.Sprintf(
+						"code line is longer than %d characters",
+						LintMaxCodeLineLength,
+					),
+				})
+			}
+
+			continue
+		}
+
+		if groups := reFence.FindSubmatchIndex(line); groups != nil {
+			fence = line[groups[2]:groups[3]]
+
+			info := string(line[groups[3]:])
+
+			for _, err := range ValidateInfoString(info) {
+				issues = append(issues, LintIssue{
+					Line:     number,
+					Column:   groups[3] + strings.Index(info, err.Raw) + 1,
+					Severity: LintSeverityError,
+					Code:     LintCodeInfoString,
+					Message:  err.Error(),
+				})
+			}
+
+			continue
+		}
+
+		if groups := reATXHeading.FindSubmatchIndex(line); groups != nil &&
+			groups[5]-groups[4] == 1 {
+			if h1 {
+				issues = append(issues, LintIssue{
+					Line:     number,
+					Column:   groups[4] + 1,
+					Severity: LintSeverityWarning,
+					Code:     LintCodeMultipleH1,
+					Message:  "H1 heading is used besides the first one",
+				})
+			}
+
+			h1 = true
+		}
+
+		for _, groups := range reLintLink.FindAllSubmatchIndex(line, -1) {
+			link := string(line[groups[2]:groups[3]])
+
+			if !isBrokenLink(baseDir, link) {
+				continue
+			}
+
+			issues = append(issues, LintIssue{
+				Line:     number,
+				Column:   groups[2] + 1,
+				Severity: LintSeverityError,
+				Code:     LintCodeBrokenLink,
+				Message:  fmt.Sprintf("linked file %q is not found", link),
+			})
+		}
+	}
+
+	return issues
+}
+
+// isBrokenLink reports whether link is relative and points to a file which
+// doesn't exist in baseDir.
+func isBrokenLink(baseDir string, link string) bool {
+	uri, err := url.Parse(link)
+	if err != nil || uri.Scheme != "" || uri.Host != "" ||
+		strings.HasPrefix(uri.Path, "/") || uri.Path == "" {
+		return false
+	}
+
+	_, err = os.Stat(filepath.Join(baseDir, filepath.FromSlash(uri.Path)))
+
+	return os.IsNotExist(err)
+}
@@ -0,0 +1,70 @@
+package mark
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLintMarkdown(t *testing.T) {
+	markdown := text(
+		"# Title",
+		"",
+		"See [header](testdata/header.md) and [missing](missing.md#hash).",
+		"",
+		"# Second",
+		"",
+		"```go theme",
+		"# not a heading, [not a link](missing.md)",
+		strings.Repeat("x", LintMaxCodeLineLength+1),
+		"```",
+		"",
+		"![image](https://example.com/image.png)",
+	)
+
+	assert.Equal(t, []LintIssue{
+		{
+			Line:     3,
+			Column:   48,
+			Severity: LintSeverityError,
+			Code:     LintCodeBrokenLink,
+			Message:  `linked file "missing.md" is not found`,
+		},
+		{
+			Line:     5,
+			Column:   1,
+			Severity: LintSeverityWarning,
+			Code:     LintCodeMultipleH1,
+			Message:  "H1 heading is used besides the first one",
+		},
+		{
+			Line:     7,
+			Column:   7,
+			Severity: LintSeverityError,
+			Code:     LintCodeInfoString,
+			Message:  `theme: theme should be given as theme=<name> ("theme")`,
+		},
+		{
+			Line:     9,
+			Column:   LintMaxCodeLineLength + 1,
+			Severity: LintSeverityWarning,
+			Code:     LintCodeLongCodeLine,
+			Message:  "code line is longer than 120 characters",
+		},
+	}, LintMarkdown([]byte(markdown), "."))
+
+	// links are relative to the document, not to current directory
+	assert.Equal(t, []LintIssue{
+		{
+			Line:     1,
+			Column:   34,
+			Severity: LintSeverityError,
+			Code:     LintCodeBrokenLink,
+			Message:  `linked file "testdata/header.md" is not found`,
+		},
+	}, LintMarkdown(
+		[]byte("See [header](header.md) and [it](testdata/header.md)."),
+		"testdata",
+	))
+}
@@ -1,100 +1,1376 @@
 package mark
 
 import (
+	"bytes"
+	"html"
 	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/kovetskiy/mark/pkg/mark/stdlib"
 	"github.com/reconquest/pkg/log"
 	bf "github.com/kovetskiy/blackfriday/v2"
 )
 
+// <hr/> given as inline HTML might end up inside of paragraph, which is
+// not valid since <hr/> is a block element.
+var reParagraphHR = regexp.MustCompile(`<p>\s*<hr\s*/?>\s*</p>`)
+
+// colonPlaceholder replaces colons of namespaced tags like <ac:anchor>
+// while markdown is rendered.
+const colonPlaceholder = `---bf-COLON---`
+
+// DefaultBlackfridayExtensions are markdown syntax extensions enabled for
+// parsing documents; callers might adjust the set before compiling, e.g.
+// mark.DefaultBlackfridayExtensions &^= bf.DefinitionLists.
+var DefaultBlackfridayExtensions = bf.NoIntraEmphasis |
+	bf.Tables |
+	bf.FencedCode |
+	bf.Autolink |
+	bf.LaxHTMLBlocks |
+	bf.Strikethrough |
+	bf.SpaceHeadings |
+	bf.HeadingIDs |
+	bf.AutoHeadingIDs |
+	bf.Titleblock |
+	bf.BackslashLineBreak |
+	bf.DefinitionLists |
+	bf.NoEmptyLineBeforeBlock
+
 type ConfluenceRenderer struct {
 	bf.Renderer
 
-	Stdlib *stdlib.Lib
-}
+	Stdlib *stdlib.Lib
+
+	// SoftbreakAsBreak renders line breaks inside of paragraphs as <br/>
+	// instead of joining lines with a space.
+	SoftbreakAsBreak bool
+
+	taskSummaryInHeading bool
+	stripComments        bool
+	customTemplates      []customTemplate
+	headingCodeStrip     bool
+	sectionAnchors       bool
+	emoticons            bool
+	emoticonFallback     EmoticonFallbackStrategy
+	jiraBaseURL          string
+	confluenceBaseURL    string
+	hruleMacro           bool
+	alternatingLists     bool
+	frontMatterStrip     bool
+	imageBaseDir         string
+	headingBadges        bool
+	pageWidth            int
+	pageLinks            map[string]LinkSubstitution
+	pdfEmbed             bool
+	normalizeHeadings    bool
+	minHeadingLevel      int
+	strictHTML           bool
+	unsupportedHTML      []string
+	mathSupport          bool
+	baseURL              *url.URL
+	languageAliases      CodeBlockLanguageAliases
+
+	math []mathSpan
+
+	inBlockQuote   bool
+	tableCellDepth int
+	headingBadge   *headingBadge
+	headingIDs     map[string]int
+}
+
+// RendererOption enables optional behaviour of ConfluenceRenderer.
+type RendererOption func(*ConfluenceRenderer)
+
+// CompileOption configures CompileMarkdown. Since CompileMarkdown owns the
+// renderer, any RendererOption is a CompileOption as well.
+type CompileOption = RendererOption
+
+type customTemplate struct {
+	name string
+	body string
+}
+
+// WithTaskSummaryInHeading appends tasks completion count like `2/5 done` as
+// status macro to heading which is immediately followed by a task list.
+func WithTaskSummaryInHeading() RendererOption {
+	return func(renderer *ConfluenceRenderer) {
+		renderer.taskSummaryInHeading = true
+	}
+}
+
+// WithCustomTemplate registers template with given name on top of the stdlib
+// ones, so it's possible to override how e.g. `ac:code` is rendered.
+func WithCustomTemplate(name, body string) CompileOption {
+	return func(renderer *ConfluenceRenderer) {
+		renderer.customTemplates = append(
+			renderer.customTemplates,
+			customTemplate{name: name, body: body},
+		)
+	}
+}
+
+// WithHeadingCodeStrip renders inline code inside of headings as plain
+// heading text.
+func WithHeadingCodeStrip() RendererOption {
+	return func(renderer *ConfluenceRenderer) {
+		renderer.headingCodeStrip = true
+	}
+}
+
+// WithSectionAnchors emits anchor macro named after heading text before
+// every heading, so the section can be linked as #Heading Text.
+func WithSectionAnchors() RendererOption {
+	return func(renderer *ConfluenceRenderer) {
+		renderer.sectionAnchors = true
+	}
+}
+
+// WithStripComments removes HTML comments from the output instead of
+// passing them through to Confluence.
+func WithStripComments() RendererOption {
+	return func(renderer *ConfluenceRenderer) {
+		renderer.stripComments = true
+	}
+}
+
+// WithHorizontalRuleMacro renders horizontal rules as Confluence macro
+// instead of <hr/>, since the latter is often stripped inside of macro
+// bodies.
+func WithHorizontalRuleMacro() RendererOption {
+	return func(renderer *ConfluenceRenderer) {
+		renderer.hruleMacro = true
+	}
+}
+
+// WithAlternatingListStyles changes marker style of nested lists at every
+// nesting level, so it's easier to tell them apart.
+func WithAlternatingListStyles() RendererOption {
+	return func(renderer *ConfluenceRenderer) {
+		renderer.alternatingLists = true
+	}
+}
+
+var (
+	// disc, circle and square
+	unorderedListStyles = []string{"disc", "circle", "square"}
+
+	// decimal, lower-alpha and lower-roman
+	orderedListStyles = []string{"1", "a", "i"}
+)
+
+// listStyle returns marker style for the list depending on how deep it is
+// nested into other lists; styles are repeated for lists deeper than three
+// levels.
+func listStyle(node *bf.Node) string {
+	level := 0
+	for parent := node.Parent; parent != nil; parent = parent.Parent {
+		if parent.Type == bf.List {
+			level++
+		}
+	}
+
+	if node.ListFlags&bf.ListTypeOrdered != 0 {
+		return orderedListStyles[level%len(orderedListStyles)]
+	}
+
+	return unorderedListStyles[level%len(unorderedListStyles)]
+}
+
+// WithFrontMatterStrip removes YAML front matter from the beginning of the
+// document, so CompileMarkdown can be given unprocessed documents.
+func WithFrontMatterStrip() RendererOption {
+	return func(renderer *ConfluenceRenderer) {
+		renderer.frontMatterStrip = true
+	}
+}
+
+var reFrontMatter = regexp.MustCompile(
+	`\A---[ \t]*\r?\n((?s:.*?))\n(?:---|\.\.\.)[ \t]*(?:\r?\n|\z)`,
+)
+
+// WithMissingImageWarnings checks that local images exist relatively to the
+// given directory and renders warning panel in place of missing ones
+// instead of broken image.
+func WithMissingImageWarnings(base string) RendererOption {
+	return func(renderer *ConfluenceRenderer) {
+		renderer.imageBaseDir = base
+	}
+}
+
+// isMissingImage reports whether destination points to the local image
+// which doesn't exist.
+func (renderer *ConfluenceRenderer) isMissingImage(dest string) bool {
+	if renderer.imageBaseDir == "" {
+		return false
+	}
+
+	uri, err := url.Parse(dest)
+	if err != nil || uri.Scheme != "" || uri.Host != "" ||
+		strings.HasPrefix(uri.Path, "/") || uri.Path == "" {
+		return false
+	}
+
+	_, err = os.Stat(filepath.Join(renderer.imageBaseDir, uri.Path))
+
+	return os.IsNotExist(err)
+}
+
+// WithSoftbreakAsBreak sets SoftbreakAsBreak of the renderer.
+func WithSoftbreakAsBreak() RendererOption {
+	return func(renderer *ConfluenceRenderer) {
+		renderer.SoftbreakAsBreak = true
+	}
+}
+
+// WithPageWidth hard-wraps lines of code blocks longer than given number of
+// characters; 0 disables wrapping.
+func WithPageWidth(cols int) CompileOption {
+	return func(renderer *ConfluenceRenderer) {
+		renderer.pageWidth = cols
+	}
+}
+
+// WithPageLinks renders links substituted by SubstituteLinks as Confluence
+// page links, which keep working when page URL changes.
+func WithPageLinks(links []LinkSubstitution) RendererOption {
+	return func(renderer *ConfluenceRenderer) {
+		renderer.pageLinks = map[string]LinkSubstitution{}
+
+		for _, link := range links {
+			if link.Space == "" || link.Title == "" {
+				continue
+			}
+
+			// hash is kept apart, since it's given as link anchor
+			if index := strings.Index(link.To, "#"); index >= 0 {
+				link.To = link.To[:index]
+			}
+
+			renderer.pageLinks[link.To] = link
+		}
+	}
+}
+
+// WithPDFEmbed renders links to PDF attachments as view-file macro, which
+// shows the document inline instead of a download link.
+func WithPDFEmbed() RendererOption {
+	return func(renderer *ConfluenceRenderer) {
+		renderer.pdfEmbed = true
+	}
+}
+
+// parsePDFAttachment returns attachment file name if link points to the PDF
+// file attached to the page, as substituted by CompileAttachmentLinks.
+func parsePDFAttachment(link string) string {
+	uri, err := url.Parse(link)
+	if err != nil || uri.Scheme != "" || uri.Host != "" ||
+		!strings.Contains(uri.Path, "/download/attachments/") {
+		return ""
+	}
+
+	if !strings.EqualFold(path.Ext(uri.Path), ".pdf") {
+		return ""
+	}
+
+	return path.Base(uri.Path)
+}
+
+// WithJiraBaseURL renders links to issues on given Jira instance, like
+// https://example.atlassian.net/browse/PROJ-123, as Jira issue macro.
+func WithJiraBaseURL(baseURL string) RendererOption {
+	return func(renderer *ConfluenceRenderer) {
+		renderer.jiraBaseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+var reJiraIssuePath = regexp.MustCompile(`^/browse/([A-Z][A-Z0-9_]*-[0-9]+)/?$`)
+
+// parseJiraIssue returns issue key if link points to the issue on the
+// configured Jira instance.
+func (renderer *ConfluenceRenderer) parseJiraIssue(link string) string {
+	if renderer.jiraBaseURL == "" ||
+		!strings.HasPrefix(link, renderer.jiraBaseURL) {
+		return ""
+	}
+
+	matches := reJiraIssuePath.FindStringSubmatch(
+		strings.TrimPrefix(link, renderer.jiraBaseURL),
+	)
+	if matches == nil {
+		return ""
+	}
+
+	return matches[1]
+}
+
+// parseMention returns username or account id of the user mentioned as
+// @[Display Name](~username) or @[Display Name](~accountId:<account id>).
+func parseMention(link string) (username string, accountID string) {
+	if !strings.HasPrefix(link, "~") || len(link) == 1 {
+		return "", ""
+	}
+
+	link = link[1:]
+
+	// links like ~/notes.md point to files in home directory
+	if strings.Contains(link, "/") {
+		return "", ""
+	}
+
+	if strings.HasPrefix(link, "accountId:") {
+		return "", strings.TrimPrefix(link, "accountId:")
+	}
+
+	return link, ""
+}
+
+// isMention reports whether node is a link mentioning the user, which is
+// given only if the link is preceded by @.
+func isMention(node *bf.Node) bool {
+	if node == nil || node.Type != bf.Link {
+		return false
+	}
+
+	if node.Prev == nil || node.Prev.Type != bf.Text ||
+		!bytes.HasSuffix(node.Prev.Literal, []byte("@")) {
+		return false
+	}
+
+	username, accountID := parseMention(string(node.LinkData.Destination))
+
+	return username != "" || accountID != ""
+}
+
+// WithConfluenceBaseURL renders links to user profiles on given Confluence
+// instance, like https://confluence.example.com/display/~username or
+// https://example.atlassian.net/wiki/people/<account id>, as profile picture
+// macro.
+func WithConfluenceBaseURL(baseURL string) RendererOption {
+	return func(renderer *ConfluenceRenderer) {
+		renderer.confluenceBaseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+var (
+	// Server and Data Center profile links look like /display/~username
+	reProfileUsername = regexp.MustCompile(`^/display/~([^/?#]+)/?$`)
+
+	// Cloud profile links look like /wiki/people/<account id>, base URL may
+	// already include /wiki part
+	reProfileAccountID = regexp.MustCompile(`/wiki/people/([^/?#]+)/?$`)
+)
+
+// parseProfileLink returns username or account id of the user whose
+// profile on the configured Confluence instance is given link pointing to.
+func (renderer *ConfluenceRenderer) parseProfileLink(
+	link string,
+) (username string, accountID string) {
+	if renderer.confluenceBaseURL == "" ||
+		!strings.HasPrefix(link, renderer.confluenceBaseURL+"/") {
+		return "", ""
+	}
+
+	path := strings.TrimPrefix(link, renderer.confluenceBaseURL)
+
+	if matches := reProfileUsername.FindStringSubmatch(path); matches != nil {
+		username, err := url.PathUnescape(matches[1])
+		if err != nil {
+			return "", ""
+		}
+
+		return username, ""
+	}
+
+	if !strings.HasPrefix(path, "/people/") &&
+		!strings.HasPrefix(path, "/wiki/people/") {
+		return "", ""
+	}
+
+	if matches := reProfileAccountID.FindStringSubmatch(link); matches != nil {
+		return "", matches[1]
+	}
+
+	return "", ""
+}
+
+// confluenceLanguages lists language keys supported by Confluence code
+// macro.
+var confluenceLanguages = map[string]bool{
+	"actionscript3": true,
+	"applescript":   true,
+	"bash":          true,
+	"coldfusion":    true,
+	"cpp":           true,
+	"csharp":        true,
+	"css":           true,
+	"delphi":        true,
+	"diff":          true,
+	"erlang":        true,
+	"groovy":        true,
+	"java":          true,
+	"javafx":        true,
+	"javascript":    true,
+	"none":          true,
+	"perl":          true,
+	"php":           true,
+	"powershell":    true,
+	"python":        true,
+	"ruby":          true,
+	"sass":          true,
+	"scala":         true,
+	"sql":           true,
+	"vb":            true,
+	"xml":           true,
+	"yaml":          true,
+}
+
+// CodeBlockLanguageAliases maps language names that Confluence code macro
+// doesn't know about to the supported language key; names are lower case.
+type CodeBlockLanguageAliases map[string]string
+
+// DefaultLanguageAliases are aliases used for code blocks unless overridden
+// by WithLanguageAliases.
+var DefaultLanguageAliases = CodeBlockLanguageAliases{
+	"c#":         "csharp",
+	"c++":        "cpp",
+	"cs":         "csharp",
+	"js":         "javascript",
+	"mysql":      "sql",
+	"pl":         "perl",
+	"postgresql": "sql",
+	"ps1":        "powershell",
+	"py":         "python",
+	"rb":         "ruby",
+	"sqlite":     "sql",
+	"yml":        "yaml",
+	"zsh":        "bash",
+}
+
+// resolve returns language key supported by Confluence for the language
+// name; names which are supported already or have no alias are kept as is.
+func (aliases CodeBlockLanguageAliases) resolve(language string) string {
+	if confluenceLanguages[language] {
+		return language
+	}
+
+	if alias, ok := aliases[strings.ToLower(language)]; ok {
+		return alias
+	}
+
+	return language
+}
+
+// WithLanguageAliases adds aliases of code block languages on top of the
+// DefaultLanguageAliases; given aliases take precedence over default ones.
+func WithLanguageAliases(aliases CodeBlockLanguageAliases) RendererOption {
+	return func(renderer *ConfluenceRenderer) {
+		merged := CodeBlockLanguageAliases{}
+
+		for name, alias := range DefaultLanguageAliases {
+			merged[name] = alias
+		}
+
+		for name, alias := range renderer.languageAliases {
+			merged[name] = alias
+		}
+
+		for name, alias := range aliases {
+			merged[strings.ToLower(name)] = alias
+		}
+
+		renderer.languageAliases = merged
+	}
+}
+
+// CodeBlockParams are parameters given in the info string of the fenced
+// code block.
+type CodeBlockParams struct {
+	Language    string
+	Collapse    bool
+	Title       string
+	Theme       string
+	LineNumbers bool
+}
+
+// ParseInfoString parses all parameters of the code block info string,
+// which takes the following form:
+//
+//	language? "collapse"? "linenumbers"? (title=<title>|"title" <any string>*)? theme=<name>?
+//
+// Language can be given as language=<name> too, values can be double quoted.
+// Pandoc-style attributes like {.python .numberLines} are supported as well.
+// Languages unknown to Confluence are replaced according to
+// DefaultLanguageAliases.
+func ParseInfoString(info string) CodeBlockParams {
+	return parseInfoString(info, DefaultLanguageAliases)
+}
+
+// parseInfoString works like ParseInfoString, but replaces languages
+// according to given aliases.
+func parseInfoString(
+	info string,
+	aliases CodeBlockLanguageAliases,
+) CodeBlockParams {
+	var params CodeBlockParams
+
+	info = expandInfoAttributes(info)
+
+	language := ""
+	hasTitle := false
+
+	for i, param := range splitExceptOnQuotes(info) {
+		switch {
+		case param == "collapse":
+			params.Collapse = true
+
+		case param == "linenumbers":
+			params.LineNumbers = true
+
+		case strings.HasPrefix(param, "title="):
+			params.Title = unquote(strings.TrimPrefix(param, "title="))
+			hasTitle = true
+
+		case strings.HasPrefix(param, "theme="):
+			params.Theme = unquote(strings.TrimPrefix(param, "theme="))
+
+		// some editors give language as language=<name> like other parameters
+		case strings.HasPrefix(param, "language="):
+			language = unquote(strings.TrimPrefix(param, "language="))
+
+		case i == 0 && param != "title" && language == "":
+			language = param
+		}
+	}
+
+	params.Language = aliases.resolve(language)
+
+	if !hasTitle {
+		params.Title = parseLegacyTitle(info)
+	}
+
+	return params
+}
+
+// parseLegacyTitle returns title given as `title <any string>` at the end of
+// the info string.
+func parseLegacyTitle(info string) string {
+	index := strings.Index(info, "title")
+	if index >= 0 {
+		// it's found, check if title is given and return it
+		start := index + 6
+		if len(info) > start {
+			title := info[start:]
+
+			params := splitExceptOnQuotes(title)
+			if len(params) == 1 {
+				return unquote(params[0])
+			}
+
+			return title
+		}
+	}
+
+	return ""
+}
+
+// Deprecated: use ParseInfoString.
+func ParseLanguage(lang string) string {
+	return ParseInfoString(lang).Language
+}
+
+// Deprecated: use ParseInfoString.
+func ParseTitle(lang string) string {
+	return ParseInfoString(lang).Title
+}
+
+// ParseTheme returns value of the theme=<name> parameter, where name can be
+// given in double quotes.
+//
+// Deprecated: use ParseInfoString.
+func ParseTheme(lang string) string {
+	return ParseInfoString(lang).Theme
+}
+
+// ParseLineNumbers reports whether code block should be shown with line
+// numbers, which is requested by `linenumbers` word in the info string.
+//
+// Deprecated: use ParseInfoString.
+func ParseLineNumbers(lang string) bool {
+	return ParseInfoString(lang).LineNumbers
+}
+
+// splitExceptOnQuotes splits info string by whitespace, but keeps double
+// quoted parts intact. Quotes can be escaped inside of them as \".
+func splitExceptOnQuotes(lang string) []string {
+	var (
+		params  []string
+		param   strings.Builder
+		quoted  bool
+		escaped bool
+	)
+
+	for _, char := range lang {
+		switch {
+		case escaped:
+			escaped = false
+
+		case char == '\\' && quoted:
+			escaped = true
+
+		case char == '"':
+			quoted = !quoted
+
+		case unicode.IsSpace(char) && !quoted:
+			if param.Len() > 0 {
+				params = append(params, param.String())
+				param.Reset()
+			}
+
+			continue
+		}
+
+		param.WriteRune(char)
+	}
+
+	if param.Len() > 0 {
+		params = append(params, param.String())
+	}
+
+	return params
+}
+
+// unquote strips surrounding double quotes from the value and unescapes
+// quotes inside of it.
+func unquote(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+
+	return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(
+		value[1 : len(value)-1],
+	)
+}
+
+// ParseImageSize extracts `width` and `height` query parameters from an
+// image destination like `image.png?width=500&height=300` and returns them
+// along with the destination stripped of those parameters.
+func ParseImageSize(dest string) (string, string, string) {
+	uri, err := url.Parse(dest)
+	if err != nil {
+		return dest, "", ""
+	}
+
+	query := uri.Query()
+
+	width := query.Get("width")
+	height := query.Get("height")
+
+	if width == "" && height == "" {
+		return dest, "", ""
+	}
+
+	query.Del("width")
+	query.Del("height")
+
+	uri.RawQuery = query.Encode()
+
+	return uri.String(), width, height
+}
+
+// nodeText returns concatenated literal text of the node and its children.
+func nodeText(node *bf.Node) string {
+	var buffer bytes.Buffer
+
+	node.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		if entering {
+			buffer.Write(node.Literal)
+		}
+
+		return bf.GoToNext
+	})
+
+	return buffer.String()
+}
+
+// blockQuoteDepth returns how many blockquotes the node is nested in.
+func blockQuoteDepth(node *bf.Node) int {
+	depth := 0
+
+	for parent := node.Parent; parent != nil; parent = parent.Parent {
+		if parent.Type == bf.BlockQuote {
+			depth++
+		}
+	}
+
+	return depth
+}
+
+// hasAncestor reports whether any of the node parents is of given type.
+func hasAncestor(node *bf.Node, nodeType bf.NodeType) bool {
+	for parent := node.Parent; parent != nil; parent = parent.Parent {
+		if parent.Type == nodeType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// renderText renders given literal as if it was a content of the text node.
+func (renderer *ConfluenceRenderer) renderText(
+	writer io.Writer,
+	node *bf.Node,
+	literal []byte,
+	entering bool,
+) {
+	if len(literal) == 0 {
+		return
+	}
+
+	text := *node
+	text.Literal = literal
+
+	renderer.Renderer.RenderNode(writer, &text, entering)
+}
+
+// renderFootnote renders footnote item as footnote macro; content of
+// single-paragraph footnote is rendered without the paragraph.
+func (renderer *ConfluenceRenderer) renderFootnote(
+	writer io.Writer,
+	footnote *bf.Node,
+) {
+	var body bytes.Buffer
+
+	content := footnote
+	if footnote.FirstChild != nil &&
+		footnote.FirstChild == footnote.LastChild &&
+		footnote.FirstChild.Type == bf.Paragraph {
+		content = footnote.FirstChild
+	}
+
+	for child := content.FirstChild; child != nil; child = child.Next {
+		child.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+			return renderer.RenderNode(&body, node, entering)
+		})
+	}
+
+	renderer.Stdlib.Templates.ExecuteTemplate(
+		writer,
+		"ac:footnote",
+		struct {
+			Body string
+		}{
+			strings.TrimSpace(body.String()),
+		},
+	)
+}
+
+// isBlankParagraph reports whether paragraph has no text except whitespace.
+func isBlankParagraph(node *bf.Node) bool {
+	child := node.FirstChild
+	if child == nil {
+		return true
+	}
+
+	return child == node.LastChild &&
+		child.Type == bf.Text &&
+		len(bytes.TrimSpace(child.Literal)) == 0
+}
+
+// hasChild reports whether any of the node children is of given type.
+func hasChild(node *bf.Node, nodeType bf.NodeType) bool {
+	for child := node.FirstChild; child != nil; child = child.Next {
+		if child.Type == nodeType {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (renderer *ConfluenceRenderer) RenderNode(
+	writer io.Writer,
+	node *bf.Node,
+	entering bool,
+) bf.WalkStatus {
+	if node.Type == bf.Image && entering && renderer.baseURL != nil {
+		node.LinkData.Destination = []byte(
+			renderer.resolveImageURL(string(node.LinkData.Destination)),
+		)
+	}
+
+	if node.Type == bf.Image && entering &&
+		renderer.isMissingImage(string(node.LinkData.Destination)) {
+		log.Warningf(
+			nil,
+			"image not found: %s",
+			node.LinkData.Destination,
+		)
+
+		renderer.Stdlib.Templates.ExecuteTemplate(
+			writer,
+			"ac:box",
+			struct {
+				Name  string
+				Icon  string
+				Title string
+				Body  string
+			}{
+				Name: "warning",
+				Body: html.EscapeString(
+					"Image not found: " + string(node.LinkData.Destination),
+				),
+			},
+		)
+
+		return bf.SkipChildren
+	}
+
+	if node.Type == bf.Image && entering {
+		dest, width, height := ParseImageSize(
+			string(node.LinkData.Destination),
+		)
+
+		if width != "" || height != "" {
+			renderer.Stdlib.Templates.ExecuteTemplate(
+				writer,
+				"ac:image",
+				struct {
+					URL    string
+					Alt    string
+					Width  string
+					Height string
+				}{
+					html.EscapeString(dest),
+					html.EscapeString(nodeText(node)),
+					html.EscapeString(width),
+					html.EscapeString(height),
+				},
+			)
+
+			return bf.SkipChildren
+		}
+	}
+
+	if node.Type == bf.Link && entering && renderer.pdfEmbed {
+		name := parsePDFAttachment(string(node.LinkData.Destination))
+		if name != "" {
+			renderer.Stdlib.Templates.ExecuteTemplate(
+				writer,
+				"ac:view-file",
+				struct {
+					Name string
+				}{
+					html.EscapeString(name),
+				},
+			)
+
+			return bf.SkipChildren
+		}
+	}
+
+	if node.Type == bf.Link && entering {
+		issue := renderer.parseJiraIssue(string(node.LinkData.Destination))
+		if issue != "" {
+			renderer.Stdlib.Templates.ExecuteTemplate(
+				writer,
+				"ac:jira:ticket",
+				struct {
+					Ticket string
+				}{
+					issue,
+				},
+			)
+
+			return bf.SkipChildren
+		}
+	}
+
+	// footnotes are shown in place of references, so the list of footnotes
+	// at the end of the document is not needed
+	if node.Type == bf.List && node.IsFootnotesList {
+		return bf.SkipChildren
+	}
+
+	if node.Type == bf.Link && entering && node.LinkData.Footnote != nil {
+		renderer.renderFootnote(writer, node.LinkData.Footnote)
+
+		return bf.SkipChildren
+	}
+
+	if node.Type == bf.Link && entering && renderer.pageLinks != nil {
+		dest, anchor := string(node.LinkData.Destination), ""
+		if index := strings.Index(dest, "#"); index >= 0 {
+			dest, anchor = dest[:index], dest[index+1:]
+		}
 
-func ParseLanguage(lang string) string {
-	// lang takes the following form: language? "collapse"? ("title"? <any string>*)?
-	// let's split it by spaces
-	paramlist := strings.Fields(lang)
+		if link, ok := renderer.pageLinks[dest]; ok {
+			renderer.Stdlib.Templates.ExecuteTemplate(
+				writer,
+				"ac:link:page",
+				struct {
+					Space  string
+					Title  string
+					Anchor string
+					Text   string
+				}{
+					html.EscapeString(link.Space),
+					html.EscapeString(link.Title),
+					html.EscapeString(anchor),
+					nodeText(node),
+				},
+			)
 
-	// get the word in question, aka the first one
-	first := lang
-	if len(paramlist) > 0 {
-		first = paramlist[0]
+			return bf.SkipChildren
+		}
 	}
 
-	if first == "collapse" || first == "title" {
-		// collapsing or including a title without a language
-		return ""
+	if node.Type == bf.Link && entering && isMention(node) {
+		username, accountID := parseMention(string(node.LinkData.Destination))
+
+		renderer.Stdlib.Templates.ExecuteTemplate(
+			writer,
+			"ac:link:mention",
+			struct {
+				Username  string
+				AccountID string
+			}{
+				html.EscapeString(username),
+				html.EscapeString(accountID),
+			},
+		)
+
+		return bf.SkipChildren
 	}
-	// the default case with language being the first one
-	return first
-}
 
-func ParseTitle(lang string) string {
-	index := strings.Index(lang, "title")
-	if index >= 0 {
-		// it's found, check if title is given and return it
-		start := index + 6
-		if len(lang) > start {
-			return lang[start:]
+	if node.Type == bf.Link && entering {
+		username, accountID := renderer.parseProfileLink(
+			string(node.LinkData.Destination),
+		)
+		if username != "" || accountID != "" {
+			renderer.Stdlib.Templates.ExecuteTemplate(
+				writer,
+				"ac:profile-picture",
+				struct {
+					Username  string
+					AccountID string
+				}{
+					html.EscapeString(username),
+					html.EscapeString(accountID),
+				},
+			)
+
+			return bf.SkipChildren
 		}
 	}
-	return ""
-}
 
-func (renderer ConfluenceRenderer) RenderNode(
-	writer io.Writer,
-	node *bf.Node,
-	entering bool,
-) bf.WalkStatus {
-	if node.Type == bf.CodeBlock {
-		lang := string(node.Info)
+	if node.Type == bf.Link && entering &&
+		bytes.HasPrefix(node.LinkData.Destination, []byte("#")) {
+		renderer.Stdlib.Templates.ExecuteTemplate(
+			writer,
+			"ac:link:anchor",
+			struct {
+				Anchor string
+				Text   string
+			}{
+				html.EscapeString(string(node.LinkData.Destination[1:])),
+				nodeText(node),
+			},
+		)
+
+		return bf.SkipChildren
+	}
+
+	// Confluence doesn't accept headings inside of blockquote, so such
+	// blockquote is unwrapped and its content is rendered as is.
+	if node.Type == bf.BlockQuote && hasChild(node, bf.Heading) {
+		if entering {
+			log.Warningf(
+				nil,
+				"blockquote containing heading %q is rendered without quoting",
+				nodeText(node.FirstChild),
+			)
+		}
+
+		return bf.GoToNext
+	}
+
+	if node.Type == bf.TableCell {
+		if entering {
+			renderer.tableCellDepth++
+		} else {
+			renderer.tableCellDepth--
+		}
+	}
+
+	// Paragraphs left blank, e.g. after directive replacement, would be
+	// rendered as empty lines in Confluence.
+	if node.Type == bf.Paragraph && entering && isBlankParagraph(node) {
+		return bf.SkipChildren
+	}
+
+	// Paragraphs of list items inside of table cells add extra spacing in
+	// Confluence, so only their content is rendered.
+	if node.Type == bf.Paragraph &&
+		renderer.tableCellDepth > 0 &&
+		node.Parent != nil &&
+		node.Parent.Type == bf.Item {
+		return bf.GoToNext
+	}
+
+	if node.Type == bf.BlockQuote {
+		renderer.inBlockQuote = entering || hasAncestor(node, bf.BlockQuote)
+
+		// Confluence drops nested blockquotes, so only the outermost one is
+		// rendered and paragraphs of nested ones are marked by >
+		if hasAncestor(node, bf.BlockQuote) {
+			return bf.GoToNext
+		}
+	}
+
+	// Paragraphs inside of blockquote are written by us exactly once and
+	// without blank lines that default renderer puts between them.
+	if node.Type == bf.Paragraph &&
+		renderer.inBlockQuote &&
+		node.Parent.Type == bf.BlockQuote {
+		if entering {
+			io.WriteString(writer, "<p>")
+
+			if depth := blockQuoteDepth(node); depth > 1 {
+				io.WriteString(writer, strings.Repeat("&gt;", depth-1)+" ")
+			}
+		} else {
+			io.WriteString(writer, "</p>\n")
+		}
 
+		return bf.GoToNext
+	}
+
+	if node.Type == bf.Heading && entering && renderer.headingBadges {
+		renderer.headingBadge = extractHeadingBadge(node)
+	}
+
+	if node.Type == bf.Heading && entering && renderer.sectionAnchors {
 		renderer.Stdlib.Templates.ExecuteTemplate(
 			writer,
-			"ac:code",
+			"ac:anchor",
 			struct {
-				Language string
-				Collapse bool
-				Title    string
-				Text     string
+				Name string
 			}{
-				ParseLanguage(lang),
-				strings.Contains(lang, "collapse"),
-				ParseTitle(lang),
-				strings.TrimSuffix(string(node.Literal), "\n"),
+				html.EscapeString(nodeText(node)),
+			},
+		)
+	}
+
+	// Confluence drops id attribute of headings, so it's given as anchor
+	// macro instead to keep in-page links working.
+	if node.Type == bf.Heading && entering && node.HeadingID != "" {
+		if renderer.headingIDs == nil {
+			renderer.headingIDs = map[string]int{}
+		}
+
+		// default renderer makes ids unique, which is skipped as id is
+		// cleared, so it's done the same way here
+		id := uniqueHeadingID(renderer.headingIDs, node.HeadingID)
+
+		node.HeadingID = ""
+
+		var buffer bytes.Buffer
+
+		status := renderer.Renderer.RenderNode(&buffer, node, entering)
+
+		// anchor goes after line breaks separating heading from previous
+		// block
+		tag := bytes.TrimLeft(buffer.Bytes(), "\n")
+
+		writer.Write(buffer.Bytes()[:buffer.Len()-len(tag)])
+
+		renderer.Stdlib.Templates.ExecuteTemplate(
+			writer,
+			"ac:anchor",
+			struct {
+				Name string
+			}{
+				html.EscapeString(id),
 			},
 		)
 
+		io.WriteString(writer, "\n")
+		writer.Write(tag)
+
+		return status
+	}
+
+	if node.Type == bf.Heading && !entering && renderer.headingBadge != nil {
+		renderer.renderHeadingBadge(writer, renderer.headingBadge)
+
+		renderer.headingBadge = nil
+	}
+
+	if node.Type == bf.Heading && !entering && renderer.taskSummaryInHeading {
+		renderer.renderTaskSummary(writer, node)
+	}
+
+	if isDefinitionList(node) ||
+		(node.Type == bf.Item && isDefinitionList(node.Parent)) {
+		renderer.renderDefinitionList(writer, node, entering)
+
 		return bf.GoToNext
 	}
-	return renderer.Renderer.RenderNode(writer, node, entering)
-}
 
-// compileMarkdown will replace tags like <ac:rich-tech-body> with escaped
-// equivalent, because bf markdown parser replaces that tags with
-// <a href="ac:rich-text-body">ac:rich-text-body</a> for whatever reason.
-func CompileMarkdown(
-	markdown []byte,
-	stdlib *stdlib.Lib,
-) string {
-	log.Tracef(nil, "rendering markdown:\n%s", string(markdown))
+	if (node.Type == bf.List && isTaskList(node)) ||
+		(node.Type == bf.Item && isTaskList(node.Parent)) {
+		renderer.renderTaskList(writer, node, entering)
+
+		return bf.GoToNext
+	}
 
-	colon := regexp.MustCompile(`---bf-COLON---`)
+	// Confluence editor shows strikethrough only for <s>, not <del>
+	if node.Type == bf.Del {
+		if entering {
+			io.WriteString(writer, "<s>")
+		} else {
+			io.WriteString(writer, "</s>")
+		}
 
-	tags := regexp.MustCompile(`<(/?\S+?):(\S+?)>`)
+		return bf.GoToNext
+	}
 
-	markdown = tags.ReplaceAll(
-		markdown,
-		[]byte(`<$1`+colon.String()+`$2>`),
-	)
+	// Confluence sometimes strips <strong> inside of headings, but keeps <b>
+	if node.Type == bf.Strong && hasAncestor(node, bf.Heading) {
+		if entering {
+			io.WriteString(writer, "<b>")
+		} else {
+			io.WriteString(writer, "</b>")
+		}
+
+		return bf.GoToNext
+	}
+
+	if node.Type == bf.Softbreak && renderer.SoftbreakAsBreak {
+		io.WriteString(writer, "<br/>\n")
+
+		return bf.GoToNext
+	}
+
+	// Parser keeps soft line breaks inside of text, so text is rendered line
+	// by line when they are to be rendered as <br/>.
+	softbreaks := renderer.SoftbreakAsBreak &&
+		bytes.Contains(node.Literal, []byte("\n"))
+
+	// @ of @[Display Name](~username) is a part of the mention syntax
+	mention := isMention(node.Next)
+
+	if node.Type == bf.Text &&
+		(renderer.emoticons || isTaskMarker(node) || softbreaks || mention) {
+		text := *node
+
+		if isTaskMarker(node) {
+			// marker is not a part of the task body
+			text.Literal = text.Literal[len(taskTodoMarker):]
+		}
+
+		if mention {
+			text.Literal = text.Literal[:len(text.Literal)-1]
+		}
+
+		lines := [][]byte{text.Literal}
+		if softbreaks {
+			lines = bytes.Split(text.Literal, []byte("\n"))
+		}
+
+		for i, line := range lines {
+			if i > 0 {
+				io.WriteString(writer, "<br/>\n")
+			}
+
+			text.Literal = line
+
+			if renderer.emoticons {
+				renderer.renderEmoticons(writer, &text, entering)
+			} else {
+				renderer.renderText(writer, &text, text.Literal, entering)
+			}
+		}
+
+		return bf.GoToNext
+	}
+
+	if node.Type == bf.Code &&
+		renderer.headingCodeStrip &&
+		hasAncestor(node, bf.Heading) {
+		io.WriteString(writer, html.EscapeString(string(node.Literal)))
+
+		return bf.GoToNext
+	}
+
+	if node.Type == bf.List &&
+		entering &&
+		renderer.alternatingLists &&
+		node.ListFlags&bf.ListTypeDefinition == 0 {
+		var buffer bytes.Buffer
+
+		status := renderer.Renderer.RenderNode(&buffer, node, entering)
+
+		tag := []byte(`<ul`)
+		if node.ListFlags&bf.ListTypeOrdered != 0 {
+			tag = []byte(`<ol`)
+		}
+
+		writer.Write(
+			bytes.Replace(
+				buffer.Bytes(),
+				tag,
+				[]byte(string(tag)+` type="`+listStyle(node)+`"`),
+				1,
+			),
+		)
+
+		return status
+	}
+
+	// Default renderer takes care of line breaks around, only the tag
+	// itself is replaced.
+	if node.Type == bf.HorizontalRule {
+		var buffer bytes.Buffer
+
+		status := renderer.Renderer.RenderNode(&buffer, node, entering)
+
+		tag := []byte(`<hr/>`)
+		if renderer.hruleMacro {
+			var macro bytes.Buffer
+
+			renderer.Stdlib.Templates.ExecuteTemplate(
+				&macro,
+				"ac:horizontalrule",
+				nil,
+			)
+
+			tag = macro.Bytes()
+		}
+
+		writer.Write(bytes.Replace(buffer.Bytes(), []byte(`<hr />`), tag, 1))
+
+		return status
+	}
+
+	if node.Type == bf.HTMLSpan {
+		if tag, ok := replaceKbdTag(node.Literal); ok {
+			writer.Write(tag)
+		} else {
+			writer.Write(sanitizeHTMLSpan(node.Literal))
+		}
+
+		return bf.GoToNext
+	}
+
+	if node.Type == bf.HTMLBlock {
+		renderer.validateHTMLBlock(node.Literal)
+
+		// raw <pre> blocks are rendered as code macro, with language given
+		// by class of <code>, if any, so they look like other code blocks
+		if text, language, ok := parsePreformatted(string(node.Literal)); ok {
+			aliases := renderer.languageAliases
+			if aliases == nil {
+				aliases = DefaultLanguageAliases
+			}
+
+			renderer.Stdlib.Templates.ExecuteTemplate(
+				writer,
+				"ac:code",
+				struct {
+					Language        string
+					Collapse        bool
+					Title           string
+					Theme           string
+					LineNumbers     bool
+					MacroOutputType string
+					Text            string
+				}{
+					Language:        aliases.resolve(language),
+					MacroOutputType: "BLOCK",
+					Text:            text,
+				},
+			)
+
+			return bf.GoToNext
+		}
+	}
+
+	if node.Type == bf.CodeBlock {
+		aliases := renderer.languageAliases
+		if aliases == nil {
+			aliases = DefaultLanguageAliases
+		}
+
+		info := parseInfoString(string(node.Info), aliases)
+
+		params := struct {
+			Language        string
+			Collapse        bool
+			Title           string
+			Theme           string
+			LineNumbers     bool
+			MacroOutputType string
+			Text            string
+		}{
+			info.Language,
+			info.Collapse,
+			info.Title,
+			info.Theme,
+			info.LineNumbers,
+			// code blocks always appear on the block level
+			"BLOCK",
+			wrapLines(
+				strings.TrimSuffix(string(node.Literal), "\n"),
+				renderer.pageWidth,
+			),
+		}
+
+		// diagrams are rendered by mermaid macro and must not be wrapped
+		if params.Language == "mermaid" {
+			renderer.Stdlib.Templates.ExecuteTemplate(
+				writer,
+				"ac:mermaid",
+				struct {
+					Text string
+				}{
+					strings.TrimSuffix(string(node.Literal), "\n"),
+				},
+			)
+
+			return bf.GoToNext
+		}
+
+		// code macro with empty language is rendered oddly, so plain
+		// text blocks without any display parameters use noformat macro
+		template := "ac:code"
+		if params.Language == "" &&
+			!params.Collapse &&
+			params.Title == "" &&
+			params.Theme == "" &&
+			!params.LineNumbers {
+			template = "ac:noformat"
+		}
+
+		renderer.Stdlib.Templates.ExecuteTemplate(writer, template, params)
+
+		return bf.GoToNext
+	}
+
+	return renderer.Renderer.RenderNode(writer, node, entering)
+}
 
-	renderer := ConfluenceRenderer{
+// newConfluenceRenderer returns renderer without any options applied.
+func newConfluenceRenderer(stdlib *stdlib.Lib) *ConfluenceRenderer {
+	return &ConfluenceRenderer{
 		Renderer: bf.NewHTMLRenderer(
 			bf.HTMLRendererParameters{
 				Flags: bf.UseXHTML |
@@ -107,32 +1383,190 @@ func CompileMarkdown(
 
 		Stdlib: stdlib,
 	}
+}
+
+// applyCustomTemplates parses custom templates into a copy of stdlib, so
+// the stdlib passed by the caller is left intact.
+func (renderer *ConfluenceRenderer) applyCustomTemplates() {
+	templates, err := renderer.Stdlib.Templates.Clone()
+	if err != nil {
+		log.Errorf(err, "unable to clone stdlib templates")
+
+		return
+	}
+
+	for _, custom := range renderer.customTemplates {
+		_, err := templates.New(custom.name).Parse(custom.body)
+		if err != nil {
+			log.Errorf(
+				err,
+				"unable to parse custom template %q; using stdlib one",
+				custom.name,
+			)
+		}
+	}
+
+	renderer.Stdlib = &stdlib.Lib{
+		Macros:    renderer.Stdlib.Macros,
+		Templates: templates,
+	}
+}
+
+// CompileMarkdown works like CompileMarkdownWithError, but drops the error,
+// since problems are logged as they are found.
+func CompileMarkdown(
+	markdown []byte,
+	stdlib *stdlib.Lib,
+	options ...CompileOption,
+) string {
+	html, _ := CompileMarkdownWithError(markdown, stdlib, options...)
+
+	return html
+}
+
+// CompileMarkdownWithError will replace tags like <ac:rich-tech-body> with
+// escaped equivalent, because bf markdown parser replaces that tags with
+// <a href="ac:rich-text-body">ac:rich-text-body</a> for whatever reason.
+// Unlike CompileMarkdown, it also returns error if the document has problems
+// which are reported as errors, like HTML elements unknown to Confluence
+// under WithStrictHTMLValidation, so callers can fail on them.
+func CompileMarkdownWithError(
+	markdown []byte,
+	stdlib *stdlib.Lib,
+	options ...CompileOption,
+) (string, error) {
+	log.Tracef(nil, "rendering markdown:\n%s", string(markdown))
+
+	renderer := newConfluenceRenderer(stdlib)
+
+	for _, option := range options {
+		option(renderer)
+	}
+
+	if len(renderer.customTemplates) > 0 {
+		renderer.applyCustomTemplates()
+	}
+
+	// editors on Windows tend to save UTF-8 files with byte order mark,
+	// which would end up in the text of the first node otherwise
+	markdown = bytes.TrimPrefix(markdown, []byte("\xEF\xBB\xBF"))
+
+	if renderer.frontMatterStrip {
+		markdown = reFrontMatter.ReplaceAll(markdown, nil)
+	}
+
+	markdown = renderer.processDirectives(markdown)
+
+	markdown = renderer.processHeadingAttributes(markdown)
+
+	markdown = renderer.processHighlights(markdown)
+
+	// normalized after directives, since contents of ```tab directives
+	// would be taken for code blocks otherwise
+	if renderer.normalizeHeadings {
+		markdown = normalizeHeadingLevels(markdown, renderer.minHeadingLevel)
+	}
+
+	if renderer.mathSupport {
+		markdown = renderer.extractMath(markdown)
+	}
+
+	markdown = applyImageAttributes(markdown)
+
+	colon := regexp.MustCompile(colonPlaceholder)
+
+	tags := regexp.MustCompile(`<(/?\S+?):(\S+?)>`)
+
+	markdown = tags.ReplaceAll(
+		markdown,
+		[]byte(`<$1`+colon.String()+`$2>`),
+	)
 
 	html := bf.Run(
 		markdown,
 		bf.WithRenderer(renderer),
-		bf.WithExtensions(
-			bf.NoIntraEmphasis|
-				bf.Tables|
-				bf.FencedCode|
-				bf.Autolink|
-				bf.LaxHTMLBlocks|
-				bf.Strikethrough|
-				bf.SpaceHeadings|
-				bf.HeadingIDs|
-				bf.AutoHeadingIDs|
-				bf.Titleblock|
-				bf.BackslashLineBreak|
-				bf.DefinitionLists|
-				bf.NoEmptyLineBeforeBlock,
-		),
+		bf.WithExtensions(DefaultBlackfridayExtensions),
 	)
 
 	html = colon.ReplaceAll(html, []byte(`:`))
 
+	html = renderer.restoreMath(html)
+
+	html = processComments(html, renderer.stripComments)
+
+	html = renderer.convertDetails(html)
+
+	html = renderer.convertColoredSpans(html)
+
+	html = unwrapDirectives(html)
+
+	html = replaceOutsideCDATA(
+		html,
+		reParagraphHR,
+		func([]byte) []byte {
+			return []byte(`<hr/>`)
+		},
+	)
+
 	log.Tracef(nil, "rendered markdown to html:\n%s", string(html))
 
-	return string(html)
+	return string(html), renderer.htmlError()
+}
+
+// CompileMarkdownWithTOC works like CompileMarkdown, but prepends table of
+// contents macro which lists headings up to maxDepth level; maxDepth of 0
+// leaves the level to Confluence default.
+func CompileMarkdownWithTOC(
+	markdown []byte,
+	stdlib *stdlib.Lib,
+	maxDepth int,
+	options ...CompileOption,
+) string {
+	var buffer bytes.Buffer
+
+	params := map[string]string{}
+	if maxDepth > 0 {
+		params["MaxLevel"] = strconv.Itoa(maxDepth)
+	}
+
+	err := stdlib.Templates.ExecuteTemplate(&buffer, "ac:toc", params)
+	if err != nil {
+		log.Errorf(err, "unable to render table of contents")
+	}
+
+	return buffer.String() + CompileMarkdown(markdown, stdlib, options...)
+}
+
+// RenderInline renders single line of markdown like `**bold** _italic_`
+// without wrapping it into paragraph, so it can be used as a part of other
+// markup, e.g. macro parameter.
+func RenderInline(markdown []byte, stdlib *stdlib.Lib) string {
+	renderer := newConfluenceRenderer(stdlib)
+
+	document := bf.New(
+		bf.WithExtensions(DefaultBlackfridayExtensions),
+	).Parse(markdown)
+
+	var buffer bytes.Buffer
+
+	document.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		if node.Type == bf.Document {
+			return bf.GoToNext
+		}
+
+		if node.Type == bf.Paragraph {
+			// several lines given are joined as they would be in paragraph
+			if !entering && node.Next != nil {
+				buffer.WriteString(" ")
+			}
+
+			return bf.GoToNext
+		}
+
+		return renderer.RenderNode(&buffer, node, entering)
+	})
+
+	return string(bytes.TrimSpace(buffer.Bytes()))
 }
 
 // DropDocumentLeadingH1 will drop leading H1 headings to prevent
@@ -142,7 +1576,9 @@ func CompileMarkdown(
 func DropDocumentLeadingH1(
 	markdown []byte,
 ) []byte {
-	h1 := regexp.MustCompile(`^#[^#].*\n`)
+	// line ending is matched explicitly, so documents with Windows line
+	// endings get their H1 dropped along with the whole \r\n
+	h1 := regexp.MustCompile(`^#[^#][^\r\n]*\r?\n`)
 	markdown = h1.ReplaceAll(markdown, []byte(""))
 	return markdown
 }
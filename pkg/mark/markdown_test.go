@@ -1,11 +1,14 @@
 package mark
 
 import (
+	"bytes"
 	"io/ioutil"
+	"net/url"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	bf "github.com/kovetskiy/blackfriday/v2"
 	"github.com/kovetskiy/mark/pkg/mark/stdlib"
 	"github.com/stretchr/testify/assert"
 )
@@ -18,6 +21,15 @@ func text(lines ...string) string {
 	return strings.Join(lines, "\n")
 }
 
+func compile(markdown string, options ...CompileOption) string {
+	lib, err := stdlib.New(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	return CompileMarkdown([]byte(markdown), lib, options...)
+}
+
 func TestCompileMarkdown(t *testing.T) {
 	test := assert.New(t)
 
@@ -48,3 +60,931 @@ func TestCompileMarkdown(t *testing.T) {
 		test.EqualValues(string(html), actual, filename+" vs "+htmlname)
 	}
 }
+
+func TestParseInfoString(t *testing.T) {
+	test := assert.New(t)
+
+	test.Equal(CodeBlockParams{}, ParseInfoString(""))
+	test.Equal(
+		CodeBlockParams{
+			Language:    "sql",
+			Collapse:    true,
+			Title:       `The "Real" Deal`,
+			Theme:       "Midnight",
+			LineNumbers: true,
+		},
+		ParseInfoString(
+			`mysql collapse linenumbers title="The \"Real\" Deal" theme=Midnight`,
+		),
+	)
+	test.Equal(
+		CodeBlockParams{Collapse: true, Title: "A b c"},
+		ParseInfoString("collapse title A b c"),
+	)
+
+	for _, info := range []string{
+		`{.python .numberLines #example title="Example"}`,
+		`.python .numberLines #example title="Example"`,
+		`python {.numberLines title="Example"}`,
+	} {
+		test.Equal(
+			CodeBlockParams{
+				Language:    "python",
+				Title:       "Example",
+				LineNumbers: true,
+			},
+			ParseInfoString(info),
+			info,
+		)
+	}
+
+	test.Equal(CodeBlockParams{Language: "{a}"}, ParseInfoString("{a}"))
+}
+
+func TestParseTitle(t *testing.T) {
+	test := assert.New(t)
+
+	test.Equal("", ParseTitle("go"))
+	test.Equal("A b c", ParseTitle("sh title A b c"))
+	test.Equal("A b", ParseTitle(`sh title "A b"`))
+	test.Equal("O'Reilly's Guide", ParseTitle(`go title="O'Reilly's Guide"`))
+	test.Equal(`The "Real" Deal`, ParseTitle(`go title="The \"Real\" Deal"`))
+	test.Equal(
+		`The "Real" Deal`,
+		ParseTitle(`go collapse title="The \"Real\" Deal" theme=Midnight`),
+	)
+}
+
+func TestParseLanguage(t *testing.T) {
+	test := assert.New(t)
+
+	test.Equal("go", ParseLanguage("go collapse"))
+	test.Equal("go", ParseLanguage("language=go collapse"))
+	test.Equal("go", ParseLanguage(`collapse language="go" title A`))
+	test.Equal("sql", ParseLanguage("language=mysql"))
+	test.Equal("javascript", ParseLanguage("js"))
+	test.Equal("python", ParseLanguage("PY"))
+	test.Equal("rust", ParseLanguage("rust"))
+	test.Equal("", ParseLanguage("collapse title A"))
+}
+
+func TestCompileMarkdown_LanguageAliases(t *testing.T) {
+	markdown := text(
+		"```rs",
+		"fn main() {}",
+		"```",
+		"",
+		"```js",
+		"main()",
+		"```",
+		"",
+		"```bash",
+		"main",
+		"```",
+	)
+
+	output := compile(
+		markdown,
+		WithLanguageAliases(CodeBlockLanguageAliases{
+			"RS":   "rust",
+			"js":   "none",
+			"bash": "none",
+		}),
+	)
+
+	assert.Contains(
+		t,
+		output,
+		`<ac:parameter ac:name="language">rust</ac:parameter>`,
+	)
+	assert.Contains(
+		t,
+		output,
+		`<ac:parameter ac:name="language">none</ac:parameter>`,
+	)
+	assert.Contains(
+		t,
+		output,
+		`<ac:parameter ac:name="language">bash</ac:parameter>`,
+	)
+	assert.NotContains(t, output, `javascript`)
+}
+
+func TestParseTheme(t *testing.T) {
+	test := assert.New(t)
+
+	test.Equal("", ParseTheme("go"))
+	test.Equal("Midnight", ParseTheme("go theme=Midnight"))
+	test.Equal("Fade To Grey", ParseTheme(`go theme="Fade To Grey"`))
+	test.Equal("Midnight", ParseTheme(`go title="a \"b\" c" theme=Midnight`))
+	test.Equal("", ParseLanguage(`theme=Midnight`))
+}
+
+func TestCompileMarkdown_TaskSummaryInHeading(t *testing.T) {
+	markdown := text(
+		"## Release",
+		"",
+		"- [x] build",
+		"- [ ] test",
+		"- [X] ship",
+		"",
+		"## Notes",
+		"",
+		"- plain",
+	)
+
+	assert.Equal(
+		t,
+		text(
+			`<ac:structured-macro ac:name="anchor"><ac:parameter ac:name="">release</ac:parameter></ac:structured-macro>`,
+			`<h2>Release <ac:structured-macro ac:name="status">`+
+				`<ac:parameter ac:name="colour">Yellow</ac:parameter>`+
+				`<ac:parameter ac:name="title">2/3 done</ac:parameter>`+
+				`<ac:parameter ac:name="subtle">false</ac:parameter>`+
+				`</ac:structured-macro></h2>`,
+			"<ac:task-list>",
+			"<ac:task>",
+			"<ac:task-status>complete</ac:task-status>",
+			"<ac:task-body>build</ac:task-body>",
+			"</ac:task>",
+			"<ac:task>",
+			"<ac:task-status>incomplete</ac:task-status>",
+			"<ac:task-body>test</ac:task-body>",
+			"</ac:task>",
+			"<ac:task>",
+			"<ac:task-status>complete</ac:task-status>",
+			"<ac:task-body>ship</ac:task-body>",
+			"</ac:task>",
+			"</ac:task-list>",
+			"",
+			`<ac:structured-macro ac:name="anchor"><ac:parameter ac:name="">notes</ac:parameter></ac:structured-macro>`,
+			`<h2>Notes</h2>`,
+			"",
+			"<ul>",
+			"<li>plain</li>",
+			"</ul>",
+			"",
+		),
+		compile(markdown, WithTaskSummaryInHeading()),
+	)
+}
+
+func TestCompileMarkdown_Comments(t *testing.T) {
+	markdown := text(
+		"<!-- lint-disable -- reason -->",
+		"",
+		"text <!-- inline --> here",
+		"",
+		"```html",
+		"<!-- kept -- as is -->",
+		"```",
+	)
+
+	assert.Equal(
+		t,
+		text(
+			"<!-- lint-disable - - reason -->",
+			"",
+			"<p>text <!-- inline --> here</p>",
+			"<ac:structured-macro ac:name=\"code\">",
+			"<ac:parameter ac:name=\"language\">html</ac:parameter>",
+			"<ac:parameter ac:name=\"collapse\">false</ac:parameter>",
+			"<ac:parameter ac:name=\"atlassian-macro-output-type\">BLOCK</ac:parameter>",
+			"<ac:plain-text-body><![CDATA[<!-- kept -- as is -->]]></ac:plain-text-body>",
+			"</ac:structured-macro>",
+			"",
+		),
+		compile(markdown),
+	)
+
+	assert.Equal(
+		t,
+		text(
+			"",
+			"",
+			"<p>text  here</p>",
+			"<ac:structured-macro ac:name=\"code\">",
+			"<ac:parameter ac:name=\"language\">html</ac:parameter>",
+			"<ac:parameter ac:name=\"collapse\">false</ac:parameter>",
+			"<ac:parameter ac:name=\"atlassian-macro-output-type\">BLOCK</ac:parameter>",
+			"<ac:plain-text-body><![CDATA[<!-- kept -- as is -->]]></ac:plain-text-body>",
+			"</ac:structured-macro>",
+			"",
+		),
+		compile(markdown, WithStripComments()),
+	)
+}
+
+func TestCompileMarkdown_CustomTemplate(t *testing.T) {
+	markdown := text(
+		"```go",
+		"package main",
+		"```",
+	)
+
+	assert.Equal(
+		t,
+		`<pre lang="go">package main</pre>`,
+		compile(
+			markdown,
+			WithCustomTemplate(
+				"ac:code",
+				`<pre lang="{{ .Language }}">{{ .Text }}</pre>`,
+			),
+		),
+	)
+
+	assert.Contains(
+		t,
+		compile(markdown, WithCustomTemplate("ac:code", `{{ .Broken`)),
+		`<ac:structured-macro ac:name="code">`,
+	)
+}
+
+func TestCompileMarkdown_EmoticonMapping(t *testing.T) {
+	markdown := "Done :tick: and shipped :rocket: at 10:30:45"
+
+	assert.Equal(
+		t,
+		"<p>Done :tick: and shipped :rocket: at 10:30:45</p>\n",
+		compile(markdown),
+	)
+
+	assert.Equal(
+		t,
+		`<p>Done <ac:emoticon ac:name="tick"/> and shipped :rocket: at 10:30:45</p>`+NL,
+		compile(markdown, WithEmoticonMapping()),
+	)
+
+	assert.Equal(
+		t,
+		"<p>Done <ac:emoticon ac:name=\"tick\"/> and shipped \U0001F680 at 10:30:45</p>"+NL,
+		compile(
+			markdown,
+			WithEmoticonMapping(),
+			WithEmoticonFallback(FallbackUseUnicode),
+		),
+	)
+
+	assert.Equal(
+		t,
+		`<p>Careful <ac:emoticon ac:name="warning"/> `+
+			`<ac:emoticon ac:name="thumbs-up"/></p>`+NL,
+		compile("Careful \u26A0\uFE0F \U0001F44D", WithEmoticonMapping()),
+	)
+}
+
+func TestCompileMarkdown_HeadingCodeStrip(t *testing.T) {
+	markdown := "## Heading with `<code>`"
+
+	assert.Equal(
+		t,
+		text(
+			`<ac:structured-macro ac:name="anchor">`+
+				`<ac:parameter ac:name="">heading-with-code</ac:parameter>`+
+				`</ac:structured-macro>`,
+			`<h2>Heading with <code>&lt;code&gt;</code></h2>`,
+			"",
+		),
+		compile(markdown),
+	)
+
+	assert.Equal(
+		t,
+		text(
+			`<ac:structured-macro ac:name="anchor">`+
+				`<ac:parameter ac:name="">heading-with-code</ac:parameter>`+
+				`</ac:structured-macro>`,
+			`<h2>Heading with &lt;code&gt;</h2>`,
+			"",
+		),
+		compile(markdown, WithHeadingCodeStrip()),
+	)
+}
+
+func TestCompileMarkdown_SectionAnchors(t *testing.T) {
+	assert.Equal(
+		t,
+		text(
+			`<ac:structured-macro ac:name="anchor">`+
+				`<ac:parameter ac:name="">Usage &amp; Examples</ac:parameter>`+
+				`</ac:structured-macro>`+
+				`<ac:structured-macro ac:name="anchor">`+
+				`<ac:parameter ac:name="">usage-examples</ac:parameter>`+
+				`</ac:structured-macro>`,
+			`<h2>Usage &amp; Examples</h2>`,
+			"",
+		),
+		compile("## Usage & Examples", WithSectionAnchors()),
+	)
+}
+
+func TestDropDocumentLeadingH1(t *testing.T) {
+	assert.Equal(
+		t,
+		"text\n",
+		string(DropDocumentLeadingH1([]byte("# Title\ntext\n"))),
+	)
+
+	assert.Equal(
+		t,
+		"text\r\n",
+		string(DropDocumentLeadingH1([]byte("# Title\r\ntext\r\n"))),
+	)
+
+	assert.Equal(
+		t,
+		"## Subtitle\r\n",
+		string(DropDocumentLeadingH1([]byte("## Subtitle\r\n"))),
+	)
+}
+
+func TestCompileMarkdown_JiraBaseURL(t *testing.T) {
+	markdown := text(
+		"See [PROJ-123](https://jira.example.com/browse/PROJ-123) and",
+		"[board](https://jira.example.com/secure/RapidBoard.jspa).",
+	)
+
+	assert.Equal(
+		t,
+		text(
+			`<p>See <ac:structured-macro ac:name="jira">`+
+				`<ac:parameter ac:name="key">PROJ-123</ac:parameter>`+
+				`</ac:structured-macro> and`,
+			`<a href="https://jira.example.com/secure/RapidBoard.jspa">board</a>.</p>`,
+			"",
+		),
+		compile(markdown, WithJiraBaseURL("https://jira.example.com/")),
+	)
+
+	assert.Equal(
+		t,
+		text(
+			`<p><a href="https://jira.example.com/browse/PROJ-123">PROJ-123</a></p>`,
+			"",
+		),
+		compile("[PROJ-123](https://jira.example.com/browse/PROJ-123)"),
+	)
+}
+
+func TestCompileMarkdown_PDFEmbed(t *testing.T) {
+	markdown := text(
+		"[Report](/download/attachments/42/report.pdf?version%3D1)",
+		"",
+		"[Notes](/download/attachments/42/notes.txt?version%3D1)",
+		"",
+		"[External](https://example.com/paper.pdf)",
+	)
+
+	assert.Equal(
+		t,
+		text(
+			`<p><ac:structured-macro ac:name="view-file">`+
+				`<ac:parameter ac:name="name">report.pdf</ac:parameter>`+
+				`</ac:structured-macro></p>`,
+			"",
+			`<p><a href="/download/attachments/42/notes.txt?version%3D1">Notes</a></p>`,
+			"",
+			`<p><a href="https://example.com/paper.pdf">External</a></p>`,
+			"",
+		),
+		compile(markdown, WithPDFEmbed()),
+	)
+
+	assert.Equal(
+		t,
+		text(
+			`<p><a href="/download/attachments/42/report.pdf?version%3D1">Report</a></p>`,
+			"",
+		),
+		compile("[Report](/download/attachments/42/report.pdf?version%3D1)"),
+	)
+}
+
+func TestCompileMarkdown_ProfileLinks(t *testing.T) {
+	markdown := text(
+		"[John](https://confluence.example.com/display/~john.doe)",
+		"[Space](https://confluence.example.com/display/SPACE)",
+		"[Other](https://other.example.com/display/~john.doe)",
+	)
+
+	assert.Equal(
+		t,
+		text(
+			`<p><ac:structured-macro ac:name="profile-picture">`+
+				`<ri:user ri:username="john.doe"/>`+
+				`</ac:structured-macro>`,
+			`<a href="https://confluence.example.com/display/SPACE">Space</a>`,
+			`<a href="https://other.example.com/display/~john.doe">Other</a></p>`,
+			"",
+		),
+		compile(
+			markdown,
+			WithConfluenceBaseURL("https://confluence.example.com/"),
+		),
+	)
+
+	markdown = text(
+		"[Jane](https://example.atlassian.net/wiki/people/5b10ac8d82e05b22cc7d4ef5)",
+		"[About](https://example.atlassian.net/about/people/jane)",
+		"[Team](https://www.example.com/about/people/jane)",
+	)
+
+	for _, baseURL := range []string{
+		"https://example.atlassian.net",
+		"https://example.atlassian.net/wiki",
+	} {
+		assert.Equal(
+			t,
+			text(
+				`<p><ac:structured-macro ac:name="profile-picture">`+
+					`<ri:user ri:account-id="5b10ac8d82e05b22cc7d4ef5"/>`+
+					`</ac:structured-macro>`,
+				`<a href="https://example.atlassian.net/about/people/jane">About</a>`,
+				`<a href="https://www.example.com/about/people/jane">Team</a></p>`,
+				"",
+			),
+			compile(markdown, WithConfluenceBaseURL(baseURL)),
+		)
+	}
+
+	assert.Equal(
+		t,
+		text(
+			`<p><a href="https://example.atlassian.net/wiki/people/5b10ac8d82e05b22cc7d4ef5">Jane</a>`,
+			`<a href="https://example.atlassian.net/about/people/jane">About</a>`,
+			`<a href="https://www.example.com/about/people/jane">Team</a></p>`,
+			"",
+		),
+		compile(markdown),
+	)
+}
+
+func TestRenderNode_ListInTableCell(t *testing.T) {
+	lib, err := stdlib.New(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	renderer := &ConfluenceRenderer{
+		Renderer: bf.NewHTMLRenderer(
+			bf.HTMLRendererParameters{Flags: bf.UseXHTML},
+		),
+		Stdlib: lib,
+	}
+
+	// pipe tables can't contain lists, so the tree is built by hand as if it
+	// was produced from HTML-like cell contents
+	cell := bf.NewNode(bf.TableCell)
+	list := bf.NewNode(bf.List)
+	cell.AppendChild(list)
+
+	for _, literal := range []string{"one", "two"} {
+		item := bf.NewNode(bf.Item)
+		paragraph := bf.NewNode(bf.Paragraph)
+		text := bf.NewNode(bf.Text)
+		text.Literal = []byte(literal)
+
+		paragraph.AppendChild(text)
+		item.AppendChild(paragraph)
+		list.AppendChild(item)
+	}
+
+	var buffer bytes.Buffer
+
+	cell.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		return renderer.RenderNode(&buffer, node, entering)
+	})
+
+	assert.NotContains(t, buffer.String(), "<p>")
+	assert.Contains(t, buffer.String(), "<li>one</li>")
+	assert.Contains(t, buffer.String(), "<li>two</li>")
+	assert.Equal(t, 0, renderer.tableCellDepth)
+}
+
+func TestCompileMarkdownWithTOC(t *testing.T) {
+	lib, err := stdlib.New(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	html := CompileMarkdownWithTOC([]byte("# Heading"), lib, 3)
+
+	assert.True(
+		t,
+		strings.HasPrefix(html, `<ac:structured-macro ac:name="toc">`),
+	)
+	assert.Contains(t, html, `<ac:parameter ac:name="maxLevel">3</ac:parameter>`)
+	assert.True(t, strings.HasSuffix(html, compile("# Heading")))
+
+	html = CompileMarkdownWithTOC([]byte("# Heading"), lib, 0)
+
+	assert.Contains(t, html, `<ac:parameter ac:name="maxLevel">7</ac:parameter>`)
+}
+
+func TestCompileMarkdown_TOCDirective(t *testing.T) {
+	html := compile(text("[TOC]", "", "# Heading"))
+
+	assert.True(
+		t,
+		strings.HasPrefix(html, `<ac:structured-macro ac:name="toc">`),
+	)
+	assert.NotContains(t, html, "<p><ac:structured-macro")
+	assert.NotContains(t, html, "</ac:structured-macro></p>")
+}
+
+func TestCompileMarkdown_HorizontalRuleMacro(t *testing.T) {
+	assert.Equal(
+		t,
+		text(
+			"<p>text</p>",
+			"",
+			`<ac:structured-macro ac:name="horizontalrule"/>`,
+			"",
+		),
+		compile(text("text", "", "---"), WithHorizontalRuleMacro()),
+	)
+}
+
+func TestCompileMarkdown_AlternatingListStyles(t *testing.T) {
+	markdown := text(
+		"- one",
+		"    - two",
+		"        - three",
+		"            - four",
+		"",
+		"1. one",
+		"    1. two",
+		"        1. three",
+	)
+
+	html := compile(markdown, WithAlternatingListStyles())
+
+	for _, tag := range []string{
+		`<ul type="disc">`,
+		`<ul type="circle">`,
+		`<ul type="square">`,
+		`<ol type="1">`,
+		`<ol type="a">`,
+		`<ol type="i">`,
+	} {
+		assert.Contains(t, html, tag)
+	}
+
+	assert.Equal(t, 2, strings.Count(html, `<ul type="disc">`))
+
+	assert.NotContains(t, compile(markdown), `type=`)
+}
+
+func TestCompileMarkdown_FrontMatterStrip(t *testing.T) {
+	markdown := text(
+		"---",
+		"title: Page",
+		"tags: [a, b]",
+		"---",
+		"text",
+	)
+
+	assert.Equal(
+		t,
+		text("<p>text</p>", ""),
+		compile(markdown, WithFrontMatterStrip()),
+	)
+
+	assert.Equal(
+		t,
+		text("<p>text</p>", "", "<hr/>", ""),
+		compile(text("text", "", "---"), WithFrontMatterStrip()),
+	)
+
+	assert.Contains(t, compile(markdown), "title: Page")
+}
+
+func TestCompileMarkdown_MissingImageWarnings(t *testing.T) {
+	markdown := text(
+		"![missing](missing.png)",
+		"",
+		"![existing](images.md)",
+		"",
+		"![remote](https://example.com/missing.png)",
+	)
+
+	assert.Equal(
+		t,
+		text(
+			`<p><ac:structured-macro ac:name="warning">`,
+			`<ac:parameter ac:name="icon">false</ac:parameter>`,
+			`<ac:rich-text-body>Image not found: missing.png</ac:rich-text-body>`,
+			`</ac:structured-macro>`,
+			`</p>`,
+			"",
+			`<p><img src="images.md" alt="existing" /></p>`,
+			"",
+			`<p><img src="https://example.com/missing.png" alt="remote" /></p>`,
+			"",
+		),
+		compile(markdown, WithMissingImageWarnings("testdata")),
+	)
+}
+
+func TestCompileMarkdown_BaseURL(t *testing.T) {
+	base, err := url.Parse("https://cdn.example.com/docs")
+	if err != nil {
+		panic(err)
+	}
+
+	markdown := text(
+		"![relative](images/a.png)",
+		"",
+		"![sized](b.png?width=100)",
+		"",
+		"![attachment](/download/attachments/42/c.png)",
+		"",
+		"![remote](https://example.com/d.png)",
+	)
+
+	assert.Equal(
+		t,
+		text(
+			`<p><img src="https://cdn.example.com/docs/images/a.png" alt="relative" /></p>`,
+			"",
+			`<p><ac:image ac:alt="sized">`+
+				`<ac:parameter ac:name="width">100</ac:parameter>`+
+				`<ri:url ri:value="https://cdn.example.com/docs/b.png"/></ac:image></p>`,
+			"",
+			`<p><img src="/download/attachments/42/c.png" alt="attachment" /></p>`,
+			"",
+			`<p><img src="https://example.com/d.png" alt="remote" /></p>`,
+			"",
+		),
+		compile(markdown, WithBaseURL(base)),
+	)
+}
+
+func TestCompileMarkdown_SoftbreakAsBreak(t *testing.T) {
+	markdown := text(
+		"first line",
+		"second *line*",
+		"third line",
+	)
+
+	assert.Equal(
+		t,
+		text(
+			"<p>first line<br/>",
+			"second <em>line</em><br/>",
+			"third line</p>",
+			"",
+		),
+		compile(markdown, WithSoftbreakAsBreak()),
+	)
+
+	assert.Equal(
+		t,
+		text(
+			"<p>first line",
+			"second <em>line</em>",
+			"third line</p>",
+			"",
+		),
+		compile(markdown),
+	)
+}
+
+func TestCompileMarkdown_Mentions(t *testing.T) {
+	assert.Equal(
+		t,
+		text(
+			`<p>Ask <ac:link><ri:user ri:username="john.doe"/></ac:link> about it.</p>`,
+			"",
+		),
+		compile("Ask @[John Doe](~john.doe) about it."),
+	)
+
+	assert.Equal(
+		t,
+		text(
+			`<p><ac:link><ri:user ri:account-id="5b10ac8d82e05b22cc7d4ef5"/></ac:link></p>`,
+			"",
+		),
+		compile("@[Jane Doe](~accountId:5b10ac8d82e05b22cc7d4ef5)"),
+	)
+
+	assert.Equal(
+		t,
+		text(
+			`<p>mail@<a href="https://example.com">example</a></p>`,
+			"",
+		),
+		compile("mail@[example](https://example.com)"),
+	)
+
+	assert.Equal(
+		t,
+		text(
+			`<p><a href="~john.doe">John Doe</a> and `+
+				`@<a href="~/notes.md">notes</a></p>`,
+			"",
+		),
+		compile("[John Doe](~john.doe) and @[notes](~/notes.md)"),
+	)
+}
+
+func TestCompileMarkdown_Footnotes(t *testing.T) {
+	defer func(extensions bf.Extensions) {
+		DefaultBlackfridayExtensions = extensions
+	}(DefaultBlackfridayExtensions)
+
+	DefaultBlackfridayExtensions |= bf.Footnotes
+
+	assert.Equal(
+		t,
+		text(
+			`<p>Claim<ac:structured-macro ac:name="footnote">`+
+				`<ac:rich-text-body>See <em>source</em>.</ac:rich-text-body>`+
+				`</ac:structured-macro> made.</p>`,
+			"",
+		),
+		compile(text(
+			"Claim[^1] made.",
+			"",
+			"[^1]: See *source*.",
+		)),
+	)
+}
+
+func TestCompileMarkdown_MathSupport(t *testing.T) {
+	markdown := text(
+		"Energy is $E = mc^2$, costs $5 and $10, `$code$` and \\$escaped$.",
+		"",
+		"$$",
+		"\\sum_{i=1}^{n} a_i * b_i",
+		"$$",
+	)
+
+	assert.Equal(
+		t,
+		text(
+			`<p>Energy is <ac:structured-macro ac:name="latex">`+
+				`<ac:plain-text-body><![CDATA[E = mc^2]]></ac:plain-text-body>`+
+				`</ac:structured-macro>, costs $5 and $10, `+
+				`<code>$code$</code> and $escaped$.</p>`,
+			"",
+			`<ac:structured-macro ac:name="latex">`+
+				`<ac:plain-text-body><![CDATA[\sum_{i=1}^{n} a_i * b_i]]>`+
+				`</ac:plain-text-body></ac:structured-macro>`,
+			"",
+		),
+		compile(markdown, WithMathSupport()),
+	)
+}
+
+func TestCompileMarkdown_Strikethrough(t *testing.T) {
+	assert.Equal(
+		t,
+		text("<p>It was <s>wrong</s> right.</p>", ""),
+		compile("It was ~~wrong~~ right."),
+	)
+}
+
+func TestCompileMarkdown_StrongInHeading(t *testing.T) {
+	assert.Equal(
+		t,
+		text(
+			`<ac:structured-macro ac:name="anchor"><ac:parameter ac:name="">bold-heading</ac:parameter></ac:structured-macro>`,
+			"<h2><b>Bold</b> Heading</h2>",
+			"",
+			"<p><strong>Bold</strong> text.</p>",
+			"",
+		),
+		compile(text("## **Bold** Heading", "", "**Bold** text.")),
+	)
+}
+
+func TestCompileMarkdown_Mermaid(t *testing.T) {
+	assert.Equal(
+		t,
+		text(
+			`<ac:structured-macro ac:name="mermaid">`,
+			`<ac:plain-text-body><![CDATA[graph TD`,
+			`  A --> B]]></ac:plain-text-body>`,
+			`</ac:structured-macro>`,
+			"",
+		),
+		compile(
+			text("```mermaid", "graph TD", "  A --> B", "```"),
+			WithPageWidth(5),
+		),
+	)
+}
+
+func TestCompileMarkdown_Kbd(t *testing.T) {
+	assert.Equal(
+		t,
+		text(
+			"<p>Press <strong><code>Ctrl</code></strong>+<strong><code>C</code></strong>.</p>",
+			"",
+		),
+		compile("Press <kbd>Ctrl</kbd>+<KBD class=\"key\">C</KBD>."),
+	)
+}
+
+func TestRenderInline(t *testing.T) {
+	lib, err := stdlib.New(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	assert.Equal(
+		t,
+		"<strong>bold</strong> <em>italic</em> <code>code</code>",
+		RenderInline([]byte("**bold** _italic_ `code`"), lib),
+	)
+
+	assert.Equal(
+		t,
+		"first second",
+		RenderInline([]byte("first\n\nsecond\n"), lib),
+	)
+}
+
+func TestCompileMarkdown_ByteOrderMark(t *testing.T) {
+	assert.Equal(
+		t,
+		text(
+			`<ac:structured-macro ac:name="anchor">`+
+				`<ac:parameter ac:name="">title</ac:parameter>`+
+				`</ac:structured-macro>`,
+			`<h1>Title</h1>`,
+			"",
+		),
+		compile("\xEF\xBB\xBF# Title"),
+	)
+}
+
+func TestCompileMarkdown_PageLinks(t *testing.T) {
+	links := []LinkSubstitution{
+		{
+			From:  "docs/setup.md#install",
+			To:    "https://confluence.example.com/display/DEV/Setup#install",
+			Space: "DEV",
+			Title: "Setup",
+		},
+	}
+
+	markdown, _ := SubstituteLinks(
+		[]byte(text(
+			"See [setup *guide*](docs/setup.md#install) and",
+			"[other](https://example.com).",
+		)),
+		links,
+	)
+
+	assert.Equal(
+		t,
+		text(
+			`<p>See <ac:link ac:anchor="install">`+
+				`<ri:page ri:space-key="DEV" ri:content-title="Setup"/>`+
+				`<ac:plain-text-link-body><![CDATA[setup guide]]></ac:plain-text-link-body>`+
+				`</ac:link> and`,
+			`<a href="https://example.com">other</a>.</p>`,
+			"",
+		),
+		compile(string(markdown), WithPageLinks(links)),
+	)
+}
+
+func TestRenderNode_BlankParagraph(t *testing.T) {
+	lib, err := stdlib.New(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	renderer := &ConfluenceRenderer{
+		Renderer: bf.NewHTMLRenderer(
+			bf.HTMLRendererParameters{Flags: bf.UseXHTML},
+		),
+		Stdlib: lib,
+	}
+
+	// parser trims paragraphs, so blank ones are built by hand as if their
+	// content was removed after parsing
+	document := bf.NewNode(bf.Document)
+
+	for _, literal := range []string{" \n ", "text"} {
+		paragraph := bf.NewNode(bf.Paragraph)
+		text := bf.NewNode(bf.Text)
+		text.Literal = []byte(literal)
+
+		paragraph.AppendChild(text)
+		document.AppendChild(paragraph)
+	}
+
+	var buffer bytes.Buffer
+
+	document.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		return renderer.RenderNode(&buffer, node, entering)
+	})
+
+	assert.Equal(t, "<p>text</p>\n", buffer.String())
+}
@@ -0,0 +1,115 @@
+package mark
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strconv"
+
+	"github.com/reconquest/pkg/log"
+)
+
+// reMath matches $$block$$ and $inline$ math; escaped dollars and inline
+// code spans are matched too, so they are not taken for math. Inline math
+// can't start or end with space, so amounts like $5 and $10 are not
+// matched.
+var reMath = regexp.MustCompile(
+	"`[^`\n]*`" +
+		`|\\\$` +
+		`|(?s:\$\$(.+?)\$\$)` +
+		"|\\$([^\\s$`](?:[^$`\n]*[^\\s$`])?)\\$",
+)
+
+// mathPlaceholder wraps index of math span; it has no markdown meaning, so
+// the span gets through markdown parser untouched.
+const mathPlaceholder = "MARKMATH"
+
+type mathSpan struct {
+	body  string
+	block bool
+}
+
+// WithMathSupport renders $inline$ and $$block$$ LaTeX math as latex macro,
+// which requires LaTeX plugin to be installed in Confluence.
+func WithMathSupport() RendererOption {
+	return func(renderer *ConfluenceRenderer) {
+		renderer.mathSupport = true
+	}
+}
+
+// extractMath replaces math spans with placeholders, which are replaced
+// back with latex macros by restoreMath after markdown is rendered.
+func (renderer *ConfluenceRenderer) extractMath(markdown []byte) []byte {
+	return replaceOutsideCode(
+		markdown,
+		reMath,
+		func(match []byte) []byte {
+			groups := reMath.FindSubmatch(match)
+
+			span := mathSpan{}
+
+			switch {
+			case groups[1] != nil:
+				span.body = string(bytes.TrimSpace(groups[1]))
+				span.block = true
+
+			case groups[2] != nil:
+				span.body = string(groups[2])
+
+			// markdown parser doesn't unescape dollars
+			case string(match) == `\$`:
+				return []byte(`$`)
+
+			default:
+				return match
+			}
+
+			renderer.math = append(renderer.math, span)
+
+			return []byte(
+				mathPlaceholder +
+					strconv.Itoa(len(renderer.math)-1) +
+					mathPlaceholder,
+			)
+		},
+	)
+}
+
+// restoreMath replaces placeholders of math spans with latex macros; block
+// math is unwrapped from the paragraph it ends up in.
+func (renderer *ConfluenceRenderer) restoreMath(output []byte) []byte {
+	for index, span := range renderer.math {
+		placeholder := mathPlaceholder + strconv.Itoa(index) + mathPlaceholder
+
+		var buffer bytes.Buffer
+
+		err := renderer.Stdlib.Templates.ExecuteTemplate(
+			&buffer,
+			"ac:latex",
+			struct {
+				Body string
+			}{
+				span.body,
+			},
+		)
+		if err != nil {
+			log.Errorf(err, "unable to render math: %s", span.body)
+
+			buffer.Reset()
+			buffer.WriteString(html.EscapeString(span.body))
+		}
+
+		if span.block {
+			output = bytes.Replace(
+				output,
+				[]byte("<p>"+placeholder+"</p>"),
+				buffer.Bytes(),
+				1,
+			)
+		}
+
+		output = bytes.Replace(output, []byte(placeholder), buffer.Bytes(), 1)
+	}
+
+	return output
+}
@@ -0,0 +1,52 @@
+package mark
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// reLeadingH1 matches H1 heading at the beginning of the document, possibly
+// preceded by blank lines.
+var reLeadingH1 = regexp.MustCompile(
+	`\A\s*#[ \t]+([^\r\n]*?)[ \t#]*(?:\r?\n|\z)`,
+)
+
+// MergeInput is a document given to MergeMarkdownDocuments.
+type MergeInput struct {
+	Filename string
+	Content  []byte
+}
+
+// MergeMarkdownDocuments concatenates documents into single one, so they
+// can be published as a single page. Leading H1 of every document is
+// replaced with H2 delimiting its section; documents without H1 are
+// delimited by heading named after the file.
+func MergeMarkdownDocuments(docs []MergeInput) []byte {
+	var buffer bytes.Buffer
+
+	for i, doc := range docs {
+		content := doc.Content
+
+		title := strings.TrimSuffix(
+			filepath.Base(doc.Filename),
+			filepath.Ext(doc.Filename),
+		)
+
+		if matches := reLeadingH1.FindSubmatchIndex(content); matches != nil {
+			title = string(content[matches[2]:matches[3]])
+			content = content[matches[1]:]
+		}
+
+		if i > 0 {
+			buffer.WriteString("\n")
+		}
+
+		buffer.WriteString("## " + title + "\n\n")
+		buffer.Write(bytes.TrimSpace(content))
+		buffer.WriteString("\n")
+	}
+
+	return buffer.Bytes()
+}
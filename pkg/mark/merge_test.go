@@ -0,0 +1,45 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeMarkdownDocuments(t *testing.T) {
+	assert.Equal(
+		t,
+		text(
+			"## Install",
+			"",
+			"Run installer.",
+			"",
+			"## Usage",
+			"",
+			"### Options",
+			"",
+			"None.",
+			"",
+			"## faq",
+			"",
+			"Ask.",
+			"",
+		),
+		string(MergeMarkdownDocuments([]MergeInput{
+			{
+				Filename: "docs/install.md",
+				Content:  []byte(text("# Install", "", "Run installer.", "")),
+			},
+			{
+				Filename: "docs/usage.md",
+				Content: []byte(
+					text("", "# Usage #", "### Options", "", "None."),
+				),
+			},
+			{
+				Filename: "docs/faq.md",
+				Content:  []byte(text("Ask.", "")),
+			},
+		})),
+	)
+}
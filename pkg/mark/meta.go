@@ -4,10 +4,15 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"unicode"
 
+	"github.com/reconquest/karma-go"
 	"github.com/reconquest/pkg/log"
+	"gopkg.in/yaml.v2"
 )
 
 const (
@@ -20,6 +25,14 @@ const (
 	HeaderLabel      = `Label`
 	HeaderInclude    = `Include`
 	HeaderSidebar    = `Sidebar`
+
+	HeaderContentAppearance = `Content-Appearance`
+	HeaderPageID            = `Page-ID`
+)
+
+const (
+	ContentAppearanceFullWidth = `full-width`
+	ContentAppearanceDefault   = `default`
 )
 
 type Meta struct {
@@ -31,33 +44,300 @@ type Meta struct {
 	Sidebar     string
 	Attachments map[string]string
 	Labels      []string
+
+	// ContentAppearance is either full-width or default page width; only
+	// Confluence Cloud supports it.
+	ContentAppearance string
+
+	// PageID is numeric id of the page, which identifies it even when the
+	// same title is used in several spaces.
+	PageID string
 }
 
 var (
 	reHeaderPatternV1 = regexp.MustCompile(`\[\]:\s*#\s*\(([^:]+):\s*(.*)\)`)
 	reHeaderPatternV2 = regexp.MustCompile(`<!--\s*([^:]+):\s*(.*)\s*-->`)
+
+	rePageID = regexp.MustCompile(`^[0-9]+$`)
 )
 
 func ExtractMeta(data []byte) (*Meta, []byte, error) {
+	meta, offset, err := parseMeta(bufio.NewScanner(bytes.NewBuffer(data)))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if meta == nil {
+		return nil, data, nil
+	}
+
+	// last header might be not followed by line break
+	if offset > len(data) {
+		offset = len(data)
+	}
+
+	return meta, data[offset:], nil
+}
+
+// frontmatter lists YAML front matter keys which are used as page meta;
+// other keys, like ones used by static site generators, are ignored.
+type frontmatter struct {
+	Parent            string   `yaml:"parent"`
+	Parents           []string `yaml:"parents"`
+	Space             string   `yaml:"space"`
+	Type              string   `yaml:"type"`
+	Title             string   `yaml:"title"`
+	Layout            string   `yaml:"layout"`
+	Sidebar           string   `yaml:"sidebar"`
+	Attachments       []string `yaml:"attachments"`
+	Labels            []string `yaml:"labels"`
+	Tags              []string `yaml:"tags"`
+	ContentAppearance string   `yaml:"content-appearance"`
+	PageID            string   `yaml:"page-id"`
+}
+
+// ParseMarkdownFrontmatter works like ExtractMeta, but also reads meta from
+// YAML front matter delimited by `---`, which might be followed by usual
+// <!-- Header: value --> headers. Values given in headers take precedence
+// over front matter ones.
+func ParseMarkdownFrontmatter(markdown []byte) (*Meta, []byte, error) {
+	var front *Meta
+
+	if match := reFrontMatter.FindSubmatchIndex(markdown); match != nil {
+		var err error
+
+		front, err = parseFrontmatter(markdown[match[2]:match[3]])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		markdown = markdown[match[1]:]
+	}
+
+	headers, offset, err := parseHeaders(
+		bufio.NewScanner(bytes.NewBuffer(markdown)),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if headers != nil {
+		if offset > len(markdown) {
+			offset = len(markdown)
+		}
+
+		markdown = markdown[offset:]
+	}
+
+	meta := mergeMeta(front, headers)
+	if meta == nil {
+		return nil, markdown, nil
+	}
+
+	err = validateMeta(meta)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return meta, markdown, nil
+}
+
+// parseFrontmatter returns meta given in YAML front matter or nil if there
+// is none of the page meta keys.
+func parseFrontmatter(data []byte) (*Meta, error) {
+	var values frontmatter
+
+	err := yaml.Unmarshal(data, &values)
+	if err != nil {
+		return nil, karma.Format(err, "unable to parse front matter")
+	}
+
+	meta := &Meta{
+		Parents:           values.Parents,
+		Space:             strings.TrimSpace(values.Space),
+		Type:              strings.TrimSpace(values.Type),
+		Title:             strings.TrimSpace(values.Title),
+		Layout:            strings.TrimSpace(values.Layout),
+		Sidebar:           strings.TrimSpace(values.Sidebar),
+		Attachments:       map[string]string{},
+		Labels:            append(values.Labels, values.Tags...),
+		ContentAppearance: strings.TrimSpace(values.ContentAppearance),
+		PageID:            strings.TrimSpace(values.PageID),
+	}
+
+	if values.Parent != "" {
+		meta.Parents = append([]string{values.Parent}, meta.Parents...)
+	}
+
+	if meta.Sidebar != "" {
+		meta.Layout = "article"
+	}
+
+	for _, attachment := range values.Attachments {
+		meta.Attachments[attachment] = attachment
+	}
+
+	if meta.Space == "" && meta.Title == "" && len(meta.Parents) == 0 {
+		return nil, nil
+	}
+
+	if meta.Type == "" {
+		meta.Type = "page"
+	}
+
+	return meta, nil
+}
+
+// mergeMeta returns front matter meta overridden by meta given in headers;
+// either of them might be nil.
+func mergeMeta(front *Meta, headers *Meta) *Meta {
+	if front == nil {
+		return headers
+	}
+
+	if headers == nil {
+		return front
+	}
+
+	meta := *front
+
+	if len(headers.Parents) > 0 {
+		meta.Parents = headers.Parents
+	}
+
+	if headers.Space != "" {
+		meta.Space = headers.Space
+	}
+
+	if headers.Title != "" {
+		meta.Title = headers.Title
+	}
+
+	if headers.Layout != "" {
+		meta.Layout = headers.Layout
+	}
+
+	if headers.Sidebar != "" {
+		meta.Sidebar = headers.Sidebar
+	}
+
+	if headers.ContentAppearance != "" {
+		meta.ContentAppearance = headers.ContentAppearance
+	}
+
+	if headers.PageID != "" {
+		meta.PageID = headers.PageID
+	}
+
+	// type defaults to page in headers, so it's not known whether it was
+	// given explicitly
+	if headers.Type != "page" {
+		meta.Type = headers.Type
+	}
+
+	meta.Attachments = map[string]string{}
+	for name, path := range front.Attachments {
+		meta.Attachments[name] = path
+	}
+
+	for name, path := range headers.Attachments {
+		meta.Attachments[name] = path
+	}
+
+	meta.Labels = append(
+		append([]string{}, front.Labels...),
+		headers.Labels...,
+	)
+
+	return &meta
+}
+
+// ParseMetaFromFilename derives meta from the path of the document for
+// repositories which don't give meta in headers: `getting-started.md` is
+// titled `Getting Started`. If spaceFromDir is set, name of the directory
+// containing the document is used as the space key.
+func ParseMetaFromFilename(path string, spaceFromDir bool) *Meta {
+	name := filepath.Base(path)
+	for _, extension := range []string{".md", ".markdown"} {
+		name = strings.TrimSuffix(name, extension)
+	}
+
+	words := strings.Fields(strings.ReplaceAll(name, "-", " "))
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+
+		words[i] = string(runes)
+	}
+
+	meta := &Meta{
+		Type:  "page",
+		Title: strings.Join(words, " "),
+	}
+
+	if spaceFromDir {
+		dir := filepath.Base(filepath.Dir(path))
+		if dir != "." && dir != string(filepath.Separator) {
+			meta.Space = dir
+		}
+	}
+
+	return meta
+}
+
+// ParseMarkdownMeta reads only the metadata headers from the beginning of
+// the document and stops reading as soon as headers are over, so it's cheap
+// to check whether a large file has mark metadata at all.
+func ParseMarkdownMeta(reader io.Reader) (*Meta, error) {
+	meta, _, err := parseMeta(bufio.NewScanner(reader))
+	if err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+}
+
+// parseMeta reads header lines and returns parsed meta along with the
+// offset of the first byte after headers.
+func parseMeta(scanner *bufio.Scanner) (*Meta, int, error) {
+	meta, offset, err := parseHeaders(scanner)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if meta == nil {
+		return nil, 0, nil
+	}
+
+	err = validateMeta(meta)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return meta, offset, nil
+}
+
+// parseHeaders works like parseMeta, but doesn't check that required
+// headers are given.
+func parseHeaders(scanner *bufio.Scanner) (*Meta, int, error) {
 	var (
 		meta   *Meta
 		offset int
 	)
 
-	scanner := bufio.NewScanner(bytes.NewBuffer(data))
 	for scanner.Scan() {
 		line := scanner.Text()
 
-		if err := scanner.Err(); err != nil {
-			return nil, nil, err
-		}
-
-		offset += len(line) + 1
-
 		matches := reHeaderPatternV2.FindStringSubmatch(line)
 		if matches == nil {
 			matches = reHeaderPatternV1.FindStringSubmatch(line)
 			if matches == nil {
+				// blank line separating headers from the body goes along
+				// with headers, but the body itself is kept intact
+				if strings.TrimSpace(line) == "" {
+					offset += len(line) + 1
+				}
+
 				break
 			}
 
@@ -69,6 +349,8 @@ func ExtractMeta(data []byte) (*Meta, []byte, error) {
 			)
 		}
 
+		offset += len(line) + 1
+
 		if meta == nil {
 			meta = &Meta{}
 			meta.Type = "page" //Default if not specified
@@ -102,6 +384,14 @@ func ExtractMeta(data []byte) (*Meta, []byte, error) {
 			meta.Layout = "article"
 			meta.Sidebar = strings.TrimSpace(value)
 
+		case HeaderContentAppearance:
+			meta.ContentAppearance = value
+
+		// strings.Title keeps case of the rest of the word, so both
+		// Page-ID and page-id are matched
+		case HeaderPageID, "Page-Id":
+			meta.PageID = value
+
 		case HeaderAttachment:
 			meta.Attachments[value] = value
 
@@ -124,23 +414,53 @@ func ExtractMeta(data []byte) (*Meta, []byte, error) {
 		}
 	}
 
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+
 	if meta == nil {
-		return nil, data, nil
+		return nil, 0, nil
+	}
+
+	return meta, offset, nil
+}
+
+// validateMeta checks that required headers are given and have valid
+// values.
+func validateMeta(meta *Meta) error {
+	if meta.ContentAppearance != "" &&
+		meta.ContentAppearance != ContentAppearanceFullWidth &&
+		meta.ContentAppearance != ContentAppearanceDefault {
+		return fmt.Errorf(
+			"unknown %s header value %q, should be one of: %s, %s",
+			HeaderContentAppearance,
+			meta.ContentAppearance,
+			ContentAppearanceFullWidth,
+			ContentAppearanceDefault,
+		)
+	}
+
+	if meta.PageID != "" && !rePageID.MatchString(meta.PageID) {
+		return fmt.Errorf(
+			"%s header value %q is not a number",
+			HeaderPageID,
+			meta.PageID,
+		)
 	}
 
 	if meta.Space == "" {
-		return nil, nil, fmt.Errorf(
+		return fmt.Errorf(
 			"space key is not set (%s header is not set)",
 			HeaderSpace,
 		)
 	}
 
 	if meta.Title == "" {
-		return nil, nil, fmt.Errorf(
+		return fmt.Errorf(
 			"page title is not set (%s header is not set)",
 			HeaderTitle,
 		)
 	}
 
-	return meta, data[offset:], nil
+	return nil
 }
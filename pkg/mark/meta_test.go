@@ -0,0 +1,176 @@
+package mark
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMarkdownMeta(t *testing.T) {
+	test := assert.New(t)
+
+	document := text(
+		"<!-- Space: SPACE -->",
+		"<!-- Title: Title -->",
+		"",
+		strings.Repeat("body\n", 100000),
+	)
+
+	// reader is buffered, so a few kilobytes of body might be read along
+	// with headers, but not the whole document
+	reader := &countingReader{reader: strings.NewReader(document)}
+
+	meta, err := ParseMarkdownMeta(reader)
+	test.NoError(err)
+	test.Equal("SPACE", meta.Space)
+	test.Equal("Title", meta.Title)
+	test.Less(reader.read, len(document)/10)
+
+	meta, err = ParseMarkdownMeta(strings.NewReader("# No headers"))
+	test.NoError(err)
+	test.Nil(meta)
+
+	_, err = ParseMarkdownMeta(strings.NewReader("<!-- Title: Title -->"))
+	test.Error(err)
+
+	_, err = ParseMarkdownMeta(io.MultiReader(
+		strings.NewReader("<!-- Space: SPACE -->\n"),
+		&failingReader{},
+	))
+	test.EqualError(err, "unable to read")
+}
+
+type countingReader struct {
+	reader io.Reader
+	read   int
+}
+
+func (reader *countingReader) Read(buffer []byte) (int, error) {
+	n, err := reader.reader.Read(buffer)
+	reader.read += n
+
+	return n, err
+}
+
+type failingReader struct{}
+
+func (*failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("unable to read")
+}
+
+func TestExtractMeta_ContentAppearance(t *testing.T) {
+	test := assert.New(t)
+
+	meta, _, err := ExtractMeta([]byte(text(
+		"<!-- Space: SPACE -->",
+		"<!-- Title: Title -->",
+		"<!-- Content-Appearance: full-width -->",
+		"",
+	)))
+	test.NoError(err)
+	test.Equal(ContentAppearanceFullWidth, meta.ContentAppearance)
+
+	_, _, err = ExtractMeta([]byte(text(
+		"<!-- Space: SPACE -->",
+		"<!-- Title: Title -->",
+		"<!-- Content-Appearance: wide -->",
+		"",
+	)))
+	test.Error(err)
+}
+
+func TestParseMarkdownFrontmatter(t *testing.T) {
+	test := assert.New(t)
+
+	meta, body, err := ParseMarkdownFrontmatter([]byte(text(
+		"---",
+		"title: Title",
+		"space: SPACE",
+		"parent: Parent",
+		"tags: [docs, guide]",
+		"date: 2020-01-01",
+		"---",
+		"<!-- Title: Override -->",
+		"<!-- Label: extra -->",
+		"",
+		"body",
+	)))
+	test.NoError(err)
+	test.Equal(&Meta{
+		Parents:     []string{"Parent"},
+		Space:       "SPACE",
+		Type:        "page",
+		Title:       "Override",
+		Attachments: map[string]string{},
+		Labels:      []string{"docs", "guide", "extra"},
+	}, meta)
+	test.Equal("body", string(body))
+
+	meta, body, err = ParseMarkdownFrontmatter([]byte(text(
+		"<!-- Space: SPACE -->",
+		"<!-- Title: Title -->",
+		"body",
+	)))
+	test.NoError(err)
+	test.Equal("SPACE", meta.Space)
+	test.Equal("body", string(body))
+
+	meta, body, err = ParseMarkdownFrontmatter([]byte(text(
+		"---",
+		"date: 2020-01-01",
+		"---",
+		"body",
+	)))
+	test.NoError(err)
+	test.Nil(meta)
+	test.Equal("body", string(body))
+
+	_, _, err = ParseMarkdownFrontmatter([]byte(text(
+		"---",
+		"title: Title",
+		"---",
+		"body",
+	)))
+	test.Error(err)
+}
+
+func TestExtractMeta_PageID(t *testing.T) {
+	test := assert.New(t)
+
+	meta, _, err := ExtractMeta([]byte(text(
+		"<!-- Space: SPACE -->",
+		"<!-- Title: Title -->",
+		"<!-- page-id: 42 -->",
+		"",
+	)))
+	test.NoError(err)
+	test.Equal("42", meta.PageID)
+
+	_, _, err = ExtractMeta([]byte(text(
+		"<!-- Space: SPACE -->",
+		"<!-- Title: Title -->",
+		"<!-- Page-ID: forty-two -->",
+		"",
+	)))
+	test.Error(err)
+}
+
+func TestParseMetaFromFilename(t *testing.T) {
+	test := assert.New(t)
+
+	test.Equal(
+		&Meta{Type: "page", Title: "Getting Started"},
+		ParseMetaFromFilename("docs/DEV/getting-started.md", false),
+	)
+	test.Equal(
+		&Meta{Type: "page", Space: "DEV", Title: "API V2 Reference"},
+		ParseMetaFromFilename("docs/DEV/API-v2--reference.markdown", true),
+	)
+	test.Equal(
+		&Meta{Type: "page", Title: "Readme"},
+		ParseMetaFromFilename("readme.md", true),
+	)
+}
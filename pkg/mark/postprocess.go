@@ -0,0 +1,123 @@
+package mark
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/reconquest/pkg/log"
+)
+
+// Block-level <details> gets split into paragraphs by markdown parser, so
+// optional <p> wrappers around its tags are matched too.
+var reDetails = regexp.MustCompile(
+	`(?s)(?:<p>)?<details>\s*<summary>(.*?)</summary>(?:</p>)?` +
+		`(.*?)(?:<p>)?</details>(?:</p>)?`,
+)
+
+// convertDetails replaces <details>/<summary> HTML blocks with Confluence
+// expand macro; code examples of them are kept as is.
+func (renderer *ConfluenceRenderer) convertDetails(html []byte) []byte {
+	return replaceOutsideCDATA(html, reDetails, func(match []byte) []byte {
+		groups := reDetails.FindSubmatch(match)
+
+		var buffer bytes.Buffer
+
+		err := renderer.Stdlib.Templates.ExecuteTemplate(
+			&buffer,
+			"ac:expand",
+			struct {
+				Title string
+				Body  string
+			}{
+				string(bytes.TrimSpace(groups[1])),
+				string(bytes.TrimSpace(groups[2])),
+			},
+		)
+		if err != nil {
+			log.Errorf(err, "unable to render <details> as expand macro")
+
+			return match
+		}
+
+		return buffer.Bytes()
+	})
+}
+
+// reColoredSpan matches span which has nothing but text color in its style.
+var reColoredSpan = regexp.MustCompile(
+	`(?s)<span style="\s*colou?r\s*:\s*([#\w(),. ]+?)\s*;?\s*">(.*?)</span>`,
+)
+
+var reCDATA = regexp.MustCompile(`(?s)<!\[CDATA\[.*?\]\]>`)
+
+// replaceOutsideCDATA works like regexp.ReplaceAllFunc, but leaves CDATA
+// sections, like bodies of code macros, untouched.
+func replaceOutsideCDATA(
+	html []byte,
+	re *regexp.Regexp,
+	replace func([]byte) []byte,
+) []byte {
+	var (
+		result []byte
+		last   int
+	)
+
+	for _, section := range reCDATA.FindAllIndex(html, -1) {
+		result = append(
+			result,
+			re.ReplaceAllFunc(html[last:section[0]], replace)...,
+		)
+		result = append(result, html[section[0]:section[1]]...)
+
+		last = section[1]
+	}
+
+	return append(result, re.ReplaceAllFunc(html[last:], replace)...)
+}
+
+// convertColoredSpans replaces <span style="color: ..."> with Confluence
+// color macro, since Confluence drops style attributes.
+func (renderer *ConfluenceRenderer) convertColoredSpans(html []byte) []byte {
+	return replaceOutsideCDATA(html, reColoredSpan, func(match []byte) []byte {
+		groups := reColoredSpan.FindSubmatch(match)
+
+		var buffer bytes.Buffer
+
+		err := renderer.Stdlib.Templates.ExecuteTemplate(
+			&buffer,
+			"ac:color",
+			struct {
+				Color string
+				Body  string
+			}{
+				string(groups[1]),
+				string(groups[2]),
+			},
+		)
+		if err != nil {
+			log.Errorf(err, "unable to render colored <span> as color macro")
+
+			return match
+		}
+
+		return buffer.Bytes()
+	})
+}
+
+// Opening and closing tags of paired directives like [TOC-ZONE], macros
+// around headings with classes and block directives like [TOC] are given on
+// their own lines, so they get wrapped into paragraphs by markdown parser.
+var reDirectiveParagraph = regexp.MustCompile(
+	`<p>(<ac:structured-macro ac:name="` +
+		`(?:toc-zone|tabs|tab|info|note|tip|warning)">` +
+		`(?:<ac:parameter[^>]*>[^<]*</ac:parameter>)*<ac:rich-text-body>|` +
+		`</ac:rich-text-body></ac:structured-macro>|` +
+		`<ac:structured-macro ac:name="toc">` +
+		`(?:\s*<ac:parameter[^>]*>[^<]*</ac:parameter>)*\s*` +
+		`</ac:structured-macro>)</p>`,
+)
+
+// unwrapDirectives removes paragraphs around paired directive tags.
+func unwrapDirectives(html []byte) []byte {
+	return reDirectiveParagraph.ReplaceAll(html, []byte(`$1`))
+}
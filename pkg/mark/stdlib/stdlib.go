@@ -113,6 +113,9 @@ func templates(api *confluence.API) (*template.Template, error) {
 			/**/ `<ac:parameter ac:name="language">{{ .Language }}</ac:parameter>{{printf "\n"}}`,
 			/**/ `<ac:parameter ac:name="collapse">{{ .Collapse }}</ac:parameter>{{printf "\n"}}`,
 			/**/ `{{ if .Title }}<ac:parameter ac:name="title">{{ .Title }}</ac:parameter>{{printf "\n"}}{{ end }}`,
+			/**/ `{{ if .Theme }}<ac:parameter ac:name="theme">{{ .Theme }}</ac:parameter>{{printf "\n"}}{{ end }}`,
+			/**/ `{{ if .LineNumbers }}<ac:parameter ac:name="linenumbers">true</ac:parameter>{{printf "\n"}}{{ end }}`,
+			/**/ `{{ if .MacroOutputType }}<ac:parameter ac:name="atlassian-macro-output-type">{{ .MacroOutputType }}</ac:parameter>{{printf "\n"}}{{ end }}`,
 			/**/ `<ac:plain-text-body><![CDATA[{{ .Text | cdata }}]]></ac:plain-text-body>{{printf "\n"}}`,
 			`</ac:structured-macro>{{printf "\n"}}`,
 
@@ -120,6 +123,20 @@ func templates(api *confluence.API) (*template.Template, error) {
 			`</ac:structured-macro>{{printf "\n"}}{{ end }}`,
 		),
 
+		// This template is used for rendering code in ``` without language
+		`ac:noformat`: text(
+			`<ac:structured-macro ac:name="noformat">{{printf "\n"}}`,
+			/**/ `{{ if .MacroOutputType }}<ac:parameter ac:name="atlassian-macro-output-type">{{ .MacroOutputType }}</ac:parameter>{{printf "\n"}}{{ end }}`,
+			/**/ `<ac:plain-text-body><![CDATA[{{ .Text | cdata }}]]></ac:plain-text-body>{{printf "\n"}}`,
+			`</ac:structured-macro>{{printf "\n"}}`,
+		),
+
+		`ac:mermaid`: text(
+			`<ac:structured-macro ac:name="mermaid">{{printf "\n"}}`,
+			/**/ `<ac:plain-text-body><![CDATA[{{ .Text | cdata }}]]></ac:plain-text-body>{{printf "\n"}}`,
+			`</ac:structured-macro>{{printf "\n"}}`,
+		),
+
 		`ac:status`: text(
 			`<ac:structured-macro ac:name="status">`,
 			`<ac:parameter ac:name="colour">{{ or .Color "Grey" }}</ac:parameter>`,
@@ -138,6 +155,55 @@ func templates(api *confluence.API) (*template.Template, error) {
 			`{{ end }}`,
 		),
 
+		`ac:link:mention`: text(
+			`<ac:link>`,
+			`{{ if .AccountID }}`,
+			/**/ `<ri:user ri:account-id="{{ .AccountID }}"/>`,
+			`{{ else }}`,
+			/**/ `<ri:user ri:username="{{ .Username }}"/>`,
+			`{{ end }}`,
+			`</ac:link>`,
+		),
+
+		`ac:profile-picture`: text(
+			`<ac:structured-macro ac:name="profile-picture">`,
+			`{{ if .AccountID }}`,
+			/**/ `<ri:user ri:account-id="{{ .AccountID }}"/>`,
+			`{{ else }}`,
+			/**/ `<ri:user ri:username="{{ .Username }}"/>`,
+			`{{ end }}`,
+			`</ac:structured-macro>`,
+		),
+
+		`ac:anchor`: text(
+			`<ac:structured-macro ac:name="anchor">`,
+			`<ac:parameter ac:name="">{{ .Name }}</ac:parameter>`,
+			`</ac:structured-macro>`,
+		),
+
+		`ac:link:anchor`: text(
+			`<ac:link ac:anchor="{{ .Anchor }}">`,
+			`<ac:plain-text-link-body>`,
+			`<![CDATA[{{ .Text | cdata }}]]>`,
+			`</ac:plain-text-link-body>`,
+			`</ac:link>`,
+		),
+
+		`ac:link:page`: text(
+			`<ac:link{{ if .Anchor }} ac:anchor="{{ .Anchor }}"{{ end }}>`,
+			`<ri:page ri:space-key="{{ .Space }}" ri:content-title="{{ .Title }}"/>`,
+			`<ac:plain-text-link-body>`,
+			`<![CDATA[{{ .Text | cdata }}]]>`,
+			`</ac:plain-text-link-body>`,
+			`</ac:link>`,
+		),
+
+		`ac:view-file`: text(
+			`<ac:structured-macro ac:name="view-file">`,
+			`<ac:parameter ac:name="name">{{ .Name }}</ac:parameter>`,
+			`</ac:structured-macro>`,
+		),
+
 		`ac:jira:ticket`: text(
 			`<ac:structured-macro ac:name="jira">`,
 			`<ac:parameter ac:name="key">{{ .Ticket }}</ac:parameter>`,
@@ -154,6 +220,26 @@ func templates(api *confluence.API) (*template.Template, error) {
 			`</ac:structured-macro>{{printf "\n"}}`,
 		),
 
+		`ac:box:open`: text(
+			`<ac:structured-macro ac:name="{{ .Name }}">`,
+			`<ac:parameter ac:name="icon">{{ or .Icon "false" }}</ac:parameter>`,
+			`<ac:rich-text-body>`,
+		),
+
+		`ac:box:close`: text(
+			`</ac:rich-text-body>`,
+			`</ac:structured-macro>`,
+		),
+
+		/* https://confluence.atlassian.com/doc/expand-macro-223222352.html */
+
+		`ac:expand`: text(
+			`<ac:structured-macro ac:name="expand">`,
+			`{{ if .Title }}<ac:parameter ac:name="title">{{ .Title }}</ac:parameter>{{ end }}`,
+			`<ac:rich-text-body>{{ .Body }}</ac:rich-text-body>`,
+			`</ac:structured-macro>`,
+		),
+
 		/* https://confluence.atlassian.com/conf59/table-of-contents-macro-792499210.html */
 
 		`ac:toc`: text(
@@ -170,8 +256,93 @@ func templates(api *confluence.API) (*template.Template, error) {
 			`</ac:structured-macro>{{printf "\n"}}`,
 		),
 
+		/* https://confluence.atlassian.com/doc/table-of-contents-zone-macro-182682233.html */
+
+		`ac:toc-zone:open`: text(
+			`<ac:structured-macro ac:name="toc-zone">`,
+			`{{ range $name, $value := .Params }}`,
+			/**/ `<ac:parameter ac:name="{{ $name }}">{{ $value }}</ac:parameter>`,
+			`{{ end }}`,
+			`<ac:rich-text-body>`,
+		),
+
+		`ac:toc-zone:close`: text(
+			`</ac:rich-text-body>`,
+			`</ac:structured-macro>`,
+		),
+
+		`ac:tabs:open`: text(
+			`<ac:structured-macro ac:name="tabs">`,
+			`<ac:rich-text-body>`,
+		),
+
+		`ac:tabs:close`: text(
+			`</ac:rich-text-body>`,
+			`</ac:structured-macro>`,
+		),
+
+		`ac:tab:open`: text(
+			`<ac:structured-macro ac:name="tab">`,
+			`{{ range $name, $value := .Params }}`,
+			/**/ `<ac:parameter ac:name="{{ $name }}">{{ $value }}</ac:parameter>`,
+			`{{ end }}`,
+			`<ac:rich-text-body>`,
+		),
+
+		`ac:tab:close`: text(
+			`</ac:rich-text-body>`,
+			`</ac:structured-macro>`,
+		),
+
+		/* https://confluence.atlassian.com/doc/recently-updated-dashboard-macro-182682180.html */
+
+		`ac:recently-updated-dashboard`: text(
+			`<ac:structured-macro ac:name="recently-updated-dashboard">`,
+			`{{ range $name, $value := .Params }}`,
+			/**/ `<ac:parameter ac:name="{{ $name }}">{{ $value }}</ac:parameter>`,
+			`{{ end }}`,
+			`</ac:structured-macro>`,
+		),
+
 		/* https://confluence.atlassian.com/doc/confluence-storage-format-790796544.html */
 
+		`ac:image`: text(
+			`<ac:image{{ if .Alt }} ac:alt="{{ .Alt }}"{{ end }}>`,
+			`{{ if .Width }}<ac:parameter ac:name="width">{{ .Width }}</ac:parameter>{{ end }}`,
+			`{{ if .Height }}<ac:parameter ac:name="height">{{ .Height }}</ac:parameter>{{ end }}`,
+			`<ri:url ri:value="{{ .URL }}"/>`,
+			`</ac:image>`,
+		),
+
+		`ac:horizontalrule`: text(
+			`<ac:structured-macro ac:name="horizontalrule"/>`,
+		),
+
+		`ac:footnote`: text(
+			`<ac:structured-macro ac:name="footnote">`,
+			`<ac:rich-text-body>{{ .Body }}</ac:rich-text-body>`,
+			`</ac:structured-macro>`,
+		),
+
+		`ac:latex`: text(
+			`<ac:structured-macro ac:name="latex">`,
+			`<ac:plain-text-body><![CDATA[{{ .Body | cdata }}]]></ac:plain-text-body>`,
+			`</ac:structured-macro>`,
+		),
+
+		`ac:color`: text(
+			`<ac:structured-macro ac:name="color">`,
+			`<ac:parameter ac:name="colour">{{ .Color }}</ac:parameter>`,
+			`<ac:rich-text-body>{{ .Body }}</ac:rich-text-body>`,
+			`</ac:structured-macro>`,
+		),
+
+		`ac:highlight`: text(
+			`<ac:structured-macro ac:name="highlight">`,
+			`<ac:rich-text-body>{{ .Body }}</ac:rich-text-body>`,
+			`</ac:structured-macro>`,
+		),
+
 		`ac:emoticon`: text(
 			`<ac:emoticon ac:name="{{ .Name }}"/>`,
 		),
@@ -0,0 +1,169 @@
+package mark
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	bf "github.com/kovetskiy/blackfriday/v2"
+)
+
+var (
+	taskTodoMarker = []byte("[ ] ")
+	taskDoneMarker = []byte("[x] ")
+)
+
+// parseTaskItem checks whether given list item starts with GitHub-style
+// task marker `[ ]` or `[x]` and returns the text node holding the marker.
+func parseTaskItem(item *bf.Node) (text *bf.Node, done bool, ok bool) {
+	if item.Type != bf.Item || item.FirstChild == nil {
+		return nil, false, false
+	}
+
+	text = item.FirstChild
+	if text.Type == bf.Paragraph {
+		text = text.FirstChild
+	}
+
+	if text == nil || text.Type != bf.Text {
+		return nil, false, false
+	}
+
+	switch {
+	case bytes.HasPrefix(text.Literal, taskTodoMarker):
+		return text, false, true
+
+	case bytes.HasPrefix(bytes.ToLower(text.Literal), taskDoneMarker):
+		return text, true, true
+	}
+
+	return nil, false, false
+}
+
+// isTaskList reports whether every item of the list is a task item.
+func isTaskList(list *bf.Node) bool {
+	if list.Type != bf.List || list.FirstChild == nil {
+		return false
+	}
+
+	for item := list.FirstChild; item != nil; item = item.Next {
+		if _, _, ok := parseTaskItem(item); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// renderTaskList writes task list as Confluence <ac:task-list>, so tasks are
+// displayed as checkboxes.
+func (renderer *ConfluenceRenderer) renderTaskList(
+	writer io.Writer,
+	node *bf.Node,
+	entering bool,
+) {
+	switch node.Type {
+	case bf.List:
+		if entering {
+			io.WriteString(writer, "<ac:task-list>\n")
+		} else {
+			io.WriteString(writer, "</ac:task-list>\n")
+		}
+
+	case bf.Item:
+		if !entering {
+			io.WriteString(writer, "</ac:task-body>\n</ac:task>\n")
+
+			return
+		}
+
+		_, done, _ := parseTaskItem(node)
+
+		status := "incomplete"
+		if done {
+			status = "complete"
+		}
+
+		io.WriteString(
+			writer,
+			"<ac:task>\n<ac:task-status>"+status+"</ac:task-status>\n"+
+				"<ac:task-body>",
+		)
+	}
+}
+
+// isTaskMarker reports whether the text node holds marker of an item which
+// is rendered as a task.
+func isTaskMarker(node *bf.Node) bool {
+	item := node.Parent
+	if item != nil && item.Type == bf.Paragraph {
+		item = item.Parent
+	}
+
+	if item == nil || item.Type != bf.Item || !isTaskList(item.Parent) {
+		return false
+	}
+
+	text, _, _ := parseTaskItem(item)
+
+	return text == node
+}
+
+// countTasks returns amount of task items in the list and how many of them
+// are done.
+func countTasks(list *bf.Node) (total int, done int) {
+	list.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		if !entering || node.Type != bf.Item {
+			return bf.GoToNext
+		}
+
+		if _, isDone, ok := parseTaskItem(node); ok {
+			total++
+
+			if isDone {
+				done++
+			}
+		}
+
+		return bf.GoToNext
+	})
+
+	return total, done
+}
+
+// renderTaskSummary writes status macro with tasks completion count of the
+// task list that immediately follows the heading.
+func (renderer *ConfluenceRenderer) renderTaskSummary(
+	writer io.Writer,
+	heading *bf.Node,
+) {
+	if heading.Next == nil || heading.Next.Type != bf.List {
+		return
+	}
+
+	total, done := countTasks(heading.Next)
+	if total == 0 {
+		return
+	}
+
+	color := "Yellow"
+	if done == total {
+		color = "Green"
+	}
+
+	io.WriteString(writer, " ")
+
+	renderer.Stdlib.Templates.ExecuteTemplate(
+		writer,
+		"ac:status",
+		struct {
+			Color  string
+			Title  string
+			Subtle bool
+		}{
+			color,
+			fmt.Sprintf("%d/%d done", done, total),
+			false,
+		},
+	)
+}